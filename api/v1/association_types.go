@@ -17,12 +17,46 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// EipReleasePolicy describes how the EIP allocated by the controller is handled after it is disassociated
+// +kubebuilder:validation:Enum=Delete;Retain;ReturnToPool
+type EipReleasePolicy string
+
+const (
+	// EipReleasePolicyDelete releases the EIP back to aws, the EIP drawn from an EipPool is returned to the pool.
+	EipReleasePolicyDelete EipReleasePolicy = "Delete"
+	// EipReleasePolicyRetain keeps the EIP reserved for the pod with the same name, the EIP is released
+	// after the retention period of the controller expires, or after the StatefulSet is gone if it is sticky.
+	EipReleasePolicyRetain EipReleasePolicy = "Retain"
+	// EipReleasePolicyReturnToPool keeps the EIP allocated and makes it available to other pods.
+	EipReleasePolicyReturnToPool EipReleasePolicy = "ReturnToPool"
+)
+
+// EipBinding binds an EIP with a private IP of the pod.
+type EipBinding struct {
+	// PrivateIP is the private IP of the pod, e.g. the IP of the secondary interface attached by Multus.
+	PrivateIP string `json:"privateIP"`
+	// EipAllocationId is the allocation id of the EIP associated with the private IP.
+	EipAllocationId string `json:"eipAllocationId"`
+}
+
+// EipBindingStatus defines the observed state of the secondary binding of the association.
+type EipBindingStatus struct {
+	PrivateIP  string `json:"privateIP"`
+	Associated bool   `json:"associated"`
+	ElasticIP  string `json:"elasticIP,omitempty"`
+	// AssociationId is the id of the aws EIP association.
+	AssociationId string `json:"associationId,omitempty"`
+	// NetworkInterfaceId is the id of the aws ENI the private IP belongs to.
+	NetworkInterfaceId string `json:"networkInterfaceId,omitempty"`
+}
+
 // EksPodEipAssociationSpec defines the desired state of EksPodEipAssociation
 type EksPodEipAssociationSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -31,19 +65,81 @@ type EksPodEipAssociationSpec struct {
 	PodNamespace    string `json:"podNamespace"`
 	PodName         string `json:"podName"`
 	PrivateIP       string `json:"privateIP"`
+	// ManagedEip is true when the EIP was allocated by the controller rather than specified by the user,
+	// such an EIP is released after it is disassociated from the pod.
+	ManagedEip bool `json:"managedEip,omitempty"`
+	// EipPool is the name of the EipPool the EIP is drawn from, the EIP is returned to the pool on release.
+	EipPool string `json:"eipPool,omitempty"`
+	// StickyStatefulSet is the name of the StatefulSet owning the pod when the EIP is sticky to the ordinal,
+	// the EIP is retained for the replacement pod of the same ordinal while the pod is gone, and released by
+	// the release policy after the StatefulSet is deleted or the ordinal is scaled in.
+	StickyStatefulSet string `json:"stickyStatefulSet,omitempty"`
+	// ReleasePolicy is applied to the EIP after it is disassociated, the EIP specified by the user is never released.
+	// Defaults to Delete.
+	ReleasePolicy EipReleasePolicy `json:"releasePolicy,omitempty"`
+	// Fargate is true when the pod runs on Fargate, the private IP is the primary IP of the ENI dedicated to the pod.
+	Fargate bool `json:"fargate,omitempty"`
+	// SecondaryBindings are the EIPs associated with the private IPs of the pod other than the pod IP,
+	// they are allocated and released the same as the EIP of the pod IP.
+	// +optional
+	SecondaryBindings []EipBinding `json:"secondaryBindings,omitempty"`
+}
+
+// Bindings returns the binding of the pod IP followed by the secondary bindings.
+func (s *EksPodEipAssociationSpec) Bindings() []EipBinding {
+	return append([]EipBinding{{PrivateIP: s.PrivateIP, EipAllocationId: s.EipAllocationId}},
+		s.SecondaryBindings...)
 }
 
+// Condition types of EksPodEipAssociation
+const (
+	// EipAssociationAllocated indicates whether the EIP of the association exists in aws.
+	EipAssociationAllocated = "Allocated"
+	// EipAssociationAssociated indicates whether the EIP is associated with the private IP of the pod.
+	EipAssociationAssociated = "Associated"
+	// EipAssociationReady indicates whether the pod is reachable by the EIP.
+	EipAssociationReady = "Ready"
+	// EipAssociationDegraded indicates the association failed to be applied, the reason and message tell why.
+	EipAssociationDegraded = "Degraded"
+	// EipAssociationConflicted indicates the EIP is claimed by an older association of another pod,
+	// the association is not applied until the older one has gone.
+	EipAssociationConflicted = "Conflicted"
+)
+
 // EksPodEipAssociationStatus defines the observed state of EksPodEipAssociation
 type EksPodEipAssociationStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Associated bool   `json:"associated"`
 	ElasticIP  string `json:"elasticIP"`
+	// AssociationId is the id of the aws EIP association.
+	AssociationId string `json:"associationId,omitempty"`
+	// NetworkInterfaceId is the id of the aws ENI the private IP of the pod belongs to.
+	NetworkInterfaceId string `json:"networkInterfaceId,omitempty"`
+	// IPFamily is the family of the private IP selected from the pod IPs, the EIP is IPv4 only.
+	IPFamily corev1.IPFamily `json:"ipFamily,omitempty"`
+	// SecondaryBindings are the observed state of the secondary bindings in the order of the spec.
+	// +optional
+	SecondaryBindings []EipBindingStatus `json:"secondaryBindings,omitempty"`
+	// ObservedGeneration is the generation of the spec the status is observed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:scope=Cluster
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Pod",type=string,JSONPath=`.spec.podName`
+//+kubebuilder:printcolumn:name="Private IP",type=string,JSONPath=`.spec.privateIP`
+//+kubebuilder:printcolumn:name="Elastic IP",type=string,JSONPath=`.status.elasticIP`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // EksPodEipAssociation is the Schema for the EksPodEipAssociations API
 type EksPodEipAssociation struct {
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EipPolicySpec defines the desired state of EipPolicy
+type EipPolicySpec struct {
+	// PodSelector selects the pods the EIP is allocated to, the empty selector selects all pods.
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// NamespaceSelector selects the namespaces of the pods, the empty selector selects all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// EipPool is the name of the EipPool the EIP is drawn from, the pod annotation takes precedence over it,
+	// and it takes precedence over the namespace annotation.
+	// +optional
+	EipPool string `json:"eipPool,omitempty"`
+	// ReleasePolicy is applied to the EIP allocated by the controller after it is disassociated from the pod,
+	// the pod annotation takes precedence over it, and it takes precedence over the namespace label.
+	// +optional
+	ReleasePolicy EipReleasePolicy `json:"releasePolicy,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Pool",type=string,JSONPath=`.spec.eipPool`
+//+kubebuilder:printcolumn:name="Release Policy",type=string,JSONPath=`.spec.releasePolicy`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EipPolicy is the Schema for the EipPolicies API, the EIP is allocated to the pods selected by the policy
+// regardless of the namespace label. The first policy in the order of the name applies if several ones select a pod.
+type EipPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EipPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// EipPolicyList contains a list of EipPolicy
+type EipPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EipPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EipPolicy{}, &EipPolicyList{})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EipPoolSpec defines the desired state of EipPool
+type EipPoolSpec struct {
+	// EipAllocationIds lists the pre-provisioned EIPs of the pool.
+	// +optional
+	EipAllocationIds []string `json:"eipAllocationIds,omitempty"`
+	// TagSelector selects the EIPs of the pool by the aws tags, an EIP is selected when all the tags match.
+	// +optional
+	TagSelector map[string]string `json:"tagSelector,omitempty"`
+}
+
+// EipPoolStatus defines the observed state of EipPool
+type EipPoolStatus struct {
+	Total int `json:"total"`
+	Free  int `json:"free"`
+	Used  int `json:"used"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.total`
+//+kubebuilder:printcolumn:name="Free",type=integer,JSONPath=`.status.free`
+//+kubebuilder:printcolumn:name="Used",type=integer,JSONPath=`.status.used`
+
+// EipPool is the Schema for the EipPools API
+type EipPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EipPoolSpec   `json:"spec,omitempty"`
+	Status EipPoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// EipPoolList contains a list of EipPool
+type EipPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EipPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EipPool{}, &EipPoolList{})
+}
@@ -22,18 +22,233 @@ limitations under the License.
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *EksPodEipAssociation) DeepCopyInto(out *EksPodEipAssociation) {
+func (in *EipBinding) DeepCopyInto(out *EipBinding) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipBinding.
+func (in *EipBinding) DeepCopy() *EipBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(EipBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipBindingStatus) DeepCopyInto(out *EipBindingStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipBindingStatus.
+func (in *EipBindingStatus) DeepCopy() *EipBindingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EipBindingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPolicy) DeepCopyInto(out *EipPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPolicy.
+func (in *EipPolicy) DeepCopy() *EipPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EipPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPolicyList) DeepCopyInto(out *EipPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EipPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPolicyList.
+func (in *EipPolicyList) DeepCopy() *EipPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EipPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPolicySpec) DeepCopyInto(out *EipPolicySpec) {
+	*out = *in
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPolicySpec.
+func (in *EipPolicySpec) DeepCopy() *EipPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPool) DeepCopyInto(out *EipPool) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPool.
+func (in *EipPool) DeepCopy() *EipPool {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EipPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPoolList) DeepCopyInto(out *EipPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EipPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPoolList.
+func (in *EipPoolList) DeepCopy() *EipPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EipPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPoolSpec) DeepCopyInto(out *EipPoolSpec) {
+	*out = *in
+	if in.EipAllocationIds != nil {
+		in, out := &in.EipAllocationIds, &out.EipAllocationIds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TagSelector != nil {
+		in, out := &in.TagSelector, &out.TagSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPoolSpec.
+func (in *EipPoolSpec) DeepCopy() *EipPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipPoolStatus) DeepCopyInto(out *EipPoolStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipPoolStatus.
+func (in *EipPoolStatus) DeepCopy() *EipPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EipPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EksPodEipAssociation) DeepCopyInto(out *EksPodEipAssociation) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EksPodEipAssociation.
 func (in *EksPodEipAssociation) DeepCopy() *EksPodEipAssociation {
 	if in == nil {
@@ -87,6 +302,11 @@ func (in *EksPodEipAssociationList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EksPodEipAssociationSpec) DeepCopyInto(out *EksPodEipAssociationSpec) {
 	*out = *in
+	if in.SecondaryBindings != nil {
+		in, out := &in.SecondaryBindings, &out.SecondaryBindings
+		*out = make([]EipBinding, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EksPodEipAssociationSpec.
@@ -102,6 +322,18 @@ func (in *EksPodEipAssociationSpec) DeepCopy() *EksPodEipAssociationSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EksPodEipAssociationStatus) DeepCopyInto(out *EksPodEipAssociationStatus) {
 	*out = *in
+	if in.SecondaryBindings != nil {
+		in, out := &in.SecondaryBindings, &out.SecondaryBindings
+		*out = make([]EipBindingStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EksPodEipAssociationStatus.
@@ -1,12 +1,31 @@
 package main
 
-import "flag"
+import (
+	"flag"
+	"strings"
+	"time"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
 
 var (
 	MetricsAddr          string
 	EnableLeaderElection bool
 	ProbeAddr            string
 	AssociationNamespace string
+	IPAMStoreNamespace   string
+	StickyStatefulSetEip bool
+	EipReleasePolicy     string
+	ClusterName          string
+	VpcId                string
+	EipGCInterval        time.Duration
+	EipGCGracePeriod     time.Duration
+	EipGCDryRun          bool
+	EipRetentionPeriod   time.Duration
+	EnableWebhooks       bool
+	ExcludedNamespaces   string
+	WatchNamespaces      string
 )
 
 func init() {
@@ -18,4 +37,42 @@ func init() {
 	flag.StringVar(&AssociationNamespace, "association-namespace", "",
 		"The namespace where the EksPodEipAssociation CR is created. "+
 			"If not specified, the CR will be created in the same namespace as the Pod.")
+	flag.StringVar(&IPAMStoreNamespace, "ipam-store-namespace", "eks-pod-eip-system",
+		"The namespace where the ConfigMaps recording the EIP allocations of the pods are stored.")
+	flag.BoolVar(&StickyStatefulSetEip, "sticky-statefulset-eip", false,
+		"Keep the EIP of a StatefulSet pod for the replacement pod of the same ordinal. "+
+			"The EIP is released by the EIP garbage collector after the StatefulSet is deleted or scaled in. "+
+			"It can be overridden by the pod annotation rp.amazonaws.com/pod-eip-sticky.")
+	flag.StringVar(&EipReleasePolicy, "eip-release-policy", string(ekspodeipv1.EipReleasePolicyDelete),
+		"The policy applied to the EIP allocated by the controller after it is disassociated from the pod, "+
+			"one of Delete, Retain and ReturnToPool. It can be overridden by the namespace label or "+
+			"the pod annotation rp.amazonaws.com/pod-eip-release-policy.")
+	flag.StringVar(&ClusterName, "cluster-name", "",
+		"The name of the EKS cluster, it is tagged to the EIPs allocated by the controller and "+
+			"only the EIPs tagged with it are adopted or collected. If not specified, it is discovered by "+
+			"the tags of the EC2 instance the controller runs on. "+
+			"The vpc of the cluster is discovered by the name if --vpc-id is not specified.")
+	flag.StringVar(&VpcId, "vpc-id", "",
+		"The id of the vpc the EKS cluster runs in. If not specified, the vpc is discovered by "+
+			"the EKS cluster by --cluster-name, or by the EC2 instance metadata.")
+	flag.DurationVar(&EipGCInterval, "eip-gc-interval", time.Minute*10,
+		"The interval to collect the orphaned EIPs allocated by the controller. Set to 0 to disable the collection.")
+	flag.DurationVar(&EipGCGracePeriod, "eip-gc-grace-period", time.Minute*30,
+		"The period an EIP needs to be orphaned before it is released.")
+	flag.BoolVar(&EipGCDryRun, "eip-gc-dry-run", false,
+		"Only report the orphaned EIPs instead of releasing them.")
+	flag.DurationVar(&EipRetentionPeriod, "eip-retention-period", time.Hour*24,
+		"The period the EIP is kept for the pod with the same name by the Retain release policy, "+
+			"it is released by the EIP garbage collector then. "+
+			"The EIP of the StatefulSet pod sticky to the ordinal is kept until the StatefulSet is deleted or scaled in.")
+	flag.BoolVar(&EnableWebhooks, "enable-webhooks", false,
+		"Enable the admission webhooks reserving the EIP and injecting the annotations at the pod creation, "+
+			"and validating the EksPodEipAssociations and the pod EIP annotations. "+
+			"The webhook server certificates are required.")
+	flag.StringVar(&ExcludedNamespaces, "excluded-namespaces", strings.Join(internal.DefaultExcludedNamespaces, ","),
+		"The comma-separated glob patterns of the namespaces the EIP is never allocated to the pods in, "+
+			"e.g. kube-*,istio-system.")
+	flag.StringVar(&WatchNamespaces, "watch-namespaces", "",
+		"The comma-separated namespaces the controller watches the pods in. "+
+			"If not specified, all namespaces are watched. Restricting it reduces the memory of the cache.")
 }
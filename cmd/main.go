@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -28,12 +29,18 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
 	"github.com/zhiyanliu/eks-pod-eip/internal/controller"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+	"github.com/zhiyanliu/eks-pod-eip/internal/index"
 	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+	"github.com/zhiyanliu/eks-pod-eip/internal/metrics"
+	"github.com/zhiyanliu/eks-pod-eip/internal/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -58,11 +65,19 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	excludedNamespaces := splitList(ExcludedNamespaces)
+	if err := internal.ValidateNamespacePatterns(excludedNamespaces); err != nil {
+		setupLog.Error(err, "invalid excluded namespaces", "namespaces", ExcludedNamespaces)
+		os.Exit(1)
+	}
+	watchNamespaces := splitList(WatchNamespaces)
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     MetricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: ProbeAddr,
+		NewCache:               newCacheFunc(watchNamespaces),
 		LeaderElection:         EnableLeaderElection,
 		LeaderElectionID:       "eb794402.rp.amazonaws.com",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
@@ -82,27 +97,128 @@ func main() {
 		os.Exit(1)
 	}
 
-	awsSession := getAwsSession()
+	if err = index.SetupIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
+
+	// the store reads through the API server directly, caching all ConfigMaps of the cluster is not necessary
+	apiClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		setupLog.Error(err, "unable to create client")
+		os.Exit(1)
+	}
+
+	awsSession, err := getAwsSession()
+	if err != nil {
+		setupLog.Error(err, "unable to create aws session")
+		os.Exit(1)
+	}
+	awsEC2, err := ec2api.New(awsSession)
+	if err != nil {
+		setupLog.Error(err, "unable to create ec2 client")
+		os.Exit(1)
+	}
+	ec2Svc, err := ec2api.NewInstrumented(awsEC2)
+	if err != nil {
+		setupLog.Error(err, "unable to create ec2 client")
+		os.Exit(1)
+	}
+	clusterName, err := getEksClusterName(awsSession, ec2Svc, ClusterName)
+	if err != nil {
+		setupLog.Error(err, "unable to get the cluster name")
+		os.Exit(1)
+	}
+	// the cluster is described only if it is specified, the instance the cluster is discovered by is in its vpc
+	vpcId, err := getEksVpcId(awsSession, ec2Svc, VpcId, ClusterName)
+	if err != nil {
+		setupLog.Error(err, "unable to get the vpc id")
+		os.Exit(1)
+	}
+	setupLog.Info("running in vpc", "vpc", vpcId, "cluster", clusterName)
+	ipAddressManager, err := ipam.NewIPAddressManager(ec2Svc, vpcId, clusterName,
+		func(name string) (ipam.IPAddressStore, error) {
+			return ipam.NewConfigMapIPAddressStore(apiClient, IPAMStoreNamespace, name)
+		})
+	if err != nil {
+		setupLog.Error(err, "unable to create the ip address manager")
+		os.Exit(1)
+	}
 
 	if err = (&controller.EksPodEipAssignReconciler{
 		Client:               mgr.GetClient(),
 		Scheme:               mgr.GetScheme(),
-		IPAM:                 ipam.NewIPAddressManager(awsSession),
+		Recorder:             mgr.GetEventRecorderFor("eks-pod-eip-assign-controller"),
+		IPAM:                 ipAddressManager,
 		AssociationNamespace: AssociationNamespace,
-		VpcId:                getEksVpcId(awsSession),
+		VpcId:                vpcId,
+		StickyStatefulSetEip: StickyStatefulSetEip,
+		EipReleasePolicy:     ekspodeipv1.EipReleasePolicy(EipReleasePolicy),
+		ExcludedNamespaces:   excludedNamespaces,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "EksPodEipAssign")
 		os.Exit(1)
 	}
 	if err = (&controller.EksPodEipApplyReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("eks-pod-eip-apply-controller"),
+		EC2:      ec2Svc,
+		IPAM:     ipAddressManager,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EksPodEipApply")
+		os.Exit(1)
+	}
+	if err = (&controller.EipPoolReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
+		EC2:    ec2Svc,
+		IPAM:   ipAddressManager,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "EksPodEipApply")
+		setupLog.Error(err, "unable to create controller", "controller", "EipPool")
+		os.Exit(1)
+	}
+	if err = (&controller.EipGarbageCollector{
+		Client:          mgr.GetClient(),
+		EC2:             ec2Svc,
+		IPAM:            ipAddressManager,
+		Interval:        EipGCInterval,
+		GracePeriod:     EipGCGracePeriod,
+		DryRun:          EipGCDryRun,
+		RetentionPeriod: EipRetentionPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create garbage collector", "collector", "EipGarbageCollector")
 		os.Exit(1)
 	}
+	if EnableWebhooks {
+		if err = (&webhook.PodEipInjector{
+			Client:             mgr.GetClient(),
+			IPAM:               ipAddressManager,
+			ExcludedNamespaces: excludedNamespaces,
+			WatchNamespaces:    watchNamespaces,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+		if err = (&webhook.PodEipValidator{
+			Client:             mgr.GetClient(),
+			ExcludedNamespaces: excludedNamespaces,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+		if err = (&webhook.AssociationValidator{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EksPodEipAssociation")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if err = metrics.RegisterStateCollector(mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register metrics collector")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -2,49 +2,153 @@ package main
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
 )
 
-func getAwsSession() *session.Session {
-	return session.Must(session.NewSessionWithOptions(session.Options{
+func getAwsSession() (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
-	}))
+	})
 }
 
-func getEksVpcId(awsSession *session.Session) string {
+// getEksVpcId returns the vpc id specified, or discovers it by the EKS cluster, or by the EC2 instance
+// the program runs on. The instance metadata is not required if the vpc id or the cluster name is specified,
+// e.g. running the program off the cluster.
+func getEksVpcId(awsSession *session.Session, ec2Svc ec2api.EC2API, vpcId, clusterName string) (string, error) {
+	if vpcId != "" {
+		return vpcId, nil
+	}
+
 	if awsSession == nil {
-		panic("aws session is nil")
+		return "", fmt.Errorf("aws session is nil")
+	}
+
+	if clusterName != "" {
+		return getEksClusterVpcId(awsSession, clusterName)
+	}
+
+	return getEc2InstanceVpcId(awsSession, ec2Svc)
+}
+
+func getEksClusterVpcId(awsSession *session.Session, clusterName string) (string, error) {
+	result, err := eks.New(awsSession).DescribeCluster(&eks.DescribeClusterInput{
+		Name: aws.String(clusterName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to describe EKS cluster %s: %v", clusterName, err)
+	}
+
+	if result.Cluster == nil || result.Cluster.ResourcesVpcConfig == nil ||
+		aws.StringValue(result.Cluster.ResourcesVpcConfig.VpcId) == "" {
+		return "", fmt.Errorf("no vpc id found for EKS cluster %s", clusterName)
+	}
+
+	return aws.StringValue(result.Cluster.ResourcesVpcConfig.VpcId), nil
+}
+
+// getEksClusterName returns the cluster name specified, or discovers it by the tags of the EC2 instance
+// the program runs on, the EKS nodes are tagged with the name of the cluster they join.
+func getEksClusterName(awsSession *session.Session, ec2Svc ec2api.EC2API, clusterName string) (string, error) {
+	if clusterName != "" {
+		return clusterName, nil
+	}
+
+	if awsSession == nil {
+		return "", fmt.Errorf("aws session is nil")
+	}
+
+	instance, err := getEc2Instance(awsSession, ec2Svc)
+	if err != nil {
+		return "", err
 	}
 
+	for _, tag := range instance.Tags {
+		switch key := aws.StringValue(tag.Key); {
+		case key == "aws:eks:cluster-name" || key == "eks:cluster-name":
+			return aws.StringValue(tag.Value), nil
+		case strings.HasPrefix(key, "kubernetes.io/cluster/"):
+			return strings.TrimPrefix(key, "kubernetes.io/cluster/"), nil
+		}
+	}
+
+	return "", fmt.Errorf("no EKS cluster tag found on instance %s, specify --cluster-name",
+		aws.StringValue(instance.InstanceId))
+}
+
+func getEc2InstanceVpcId(awsSession *session.Session, ec2Svc ec2api.EC2API) (string, error) {
+	instance, err := getEc2Instance(awsSession, ec2Svc)
+	if err != nil {
+		return "", err
+	}
+
+	if aws.StringValue(instance.VpcId) == "" {
+		return "", fmt.Errorf("no vpc id found for instance %s", aws.StringValue(instance.InstanceId))
+	}
+
+	return aws.StringValue(instance.VpcId), nil
+}
+
+func getEc2Instance(awsSession *session.Session, ec2Svc ec2api.EC2API) (*ec2.Instance, error) {
 	ec2metadataSvc := ec2metadata.New(awsSession)
 
+	if !ec2metadataSvc.Available() {
+		return nil, fmt.Errorf("the instance metadata is not available, " +
+			"specify --vpc-id and --cluster-name if the program doesn't run on EC2 in an aws vpc")
+	}
+
 	doc, err := ec2metadataSvc.GetInstanceIdentityDocument()
 	if err != nil {
-		panic(fmt.Errorf("failed to get instance identity document, "+
-			"the program needs to running on EC2 or Fargate in an aws vpc: %v", err))
+		return nil, fmt.Errorf("failed to get instance identity document, "+
+			"specify --vpc-id and --cluster-name if the program doesn't run on EC2 in an aws vpc: %v", err)
 	}
 
 	instanceID := doc.InstanceID
 
-	ec2Svc := ec2.New(awsSession)
-
 	result, err := ec2Svc.DescribeInstances(&ec2.DescribeInstancesInput{
 		InstanceIds: []*string{
 			aws.String(instanceID),
 		},
 	})
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("unable to describe instance %s: %v", instanceID, err)
 	}
 
 	for _, res := range result.Reservations {
 		for _, instance := range res.Instances {
-			return *instance.VpcId
+			return instance, nil
+		}
+	}
+
+	return nil, fmt.Errorf("instance %s not found", instanceID)
+}
+
+// splitList returns the items of the comma-separated list, the empty items are ignored.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
 
-	panic(fmt.Errorf("no vpc id found for instance %s", instanceID))
+	return items
+}
+
+// newCacheFunc restricts the cache of the manager to the namespaces, the cluster scoped objects are cached as is.
+// The default cache watching all namespaces is used if no namespace is specified.
+func newCacheFunc(namespaces []string) cache.NewCacheFunc {
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	return cache.MultiNamespacedCacheBuilder(namespaces)
 }
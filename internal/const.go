@@ -1,7 +1,54 @@
 package internal
 
 const (
-	PodEipAllocationIdAnnotation = "rp.amazonaws.com/pod-eip-allocation-id"
+	PodEipAllocationIdAnnotation  = "rp.amazonaws.com/pod-eip-allocation-id"
+	PodEipPoolAnnotation          = "rp.amazonaws.com/pod-eip-pool"
+	PodEipStickyAnnotation        = "rp.amazonaws.com/pod-eip-sticky"
+	PodEipReleasePolicyAnnotation = "rp.amazonaws.com/pod-eip-release-policy"
+	PodEipReservedAnnotation      = "rp.amazonaws.com/pod-eip-reserved"
+	PodEipCountAnnotation         = "rp.amazonaws.com/pod-eip-count"
+
+	// the token the EIP is reserved for at the admission, the pod name might not be generated yet
+	PodEipReservationTokenAnnotation = "rp.amazonaws.com/pod-eip-reservation-token"
+
+	// opt the pod in or out by "true" or "false", it overrides the namespace label and the pod selector
+	PodEipAllocationEnabledLabel = "rp.amazonaws.com/pod-eip-allocation-enabled"
+
+	// the Fargate profile the pod is scheduled by, the pod has a dedicated ENI on Fargate
+	PodFargateProfileLabel = "eks.amazonaws.com/fargate-profile"
+
+	// the interfaces of the pod attached by Multus, the EIPs after the first are bound to them
+	PodNetworkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+
+	// the EIP associated with the pod, written by the controller for the downward API
+	PodEipAddressAnnotation                = "rp.amazonaws.com/pod-eip-address"
+	PodEipAssociatedAllocationIdAnnotation = "rp.amazonaws.com/pod-eip-associated-allocation-id"
+	PodEipAssociationIdAnnotation          = "rp.amazonaws.com/pod-eip-association-id"
+	PodEipAddressLabel                     = "rp.amazonaws.com/pod-eip-address"
+
+	// why the controller skipped the pod, the warning event is recorded once
+	PodEipSkippedAnnotation = "rp.amazonaws.com/pod-eip-skipped"
+
+	PodEipFinalizer = "rp.amazonaws.com/eks-pod-eip-assign"
 
 	NamespacePodEipAllocationEnabledLabel = "rp.amazonaws.com/pod-eip-allocation-enabled"
+	NamespacePodEipReleasePolicyLabel     = "rp.amazonaws.com/pod-eip-release-policy"
+
+	// the EipPool the EIPs of the pods in the namespace are drawn from by default
+	NamespacePodEipDefaultPoolAnnotation = "rp.amazonaws.com/pod-eip-default-pool"
+	// the label selector of the pods in the enabled namespace, e.g. "app in (edge,proxy)"
+	NamespacePodEipPodSelectorAnnotation = "rp.amazonaws.com/pod-eip-pod-selector"
+
+	EipManagedByTag       = "rp.amazonaws.com/managed-by"
+	EipClusterNameTag     = "rp.amazonaws.com/cluster-name"
+	EipVpcIdTag           = "rp.amazonaws.com/vpc-id"
+	EipPodNamespaceTag    = "rp.amazonaws.com/pod-namespace"
+	EipPodNameTag         = "rp.amazonaws.com/pod-name"
+	EipAssociationNameTag = "rp.amazonaws.com/association-name"
+	// whether the EIP is bound with the pod IP or a secondary private IP of the pod
+	EipRoleTag = "rp.amazonaws.com/eip-role"
+
+	EipManagedByTagValue = "eks-pod-eip"
+	EipRolePrimary       = "primary"
+	EipRoleSecondary     = "secondary"
 )
@@ -18,24 +18,54 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+	"github.com/zhiyanliu/eks-pod-eip/internal/index"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+	"github.com/zhiyanliu/eks-pod-eip/internal/metrics"
+)
+
+const (
+	associationFinalizerName = "rp.amazonaws.com/eks-pod-eip-apply"
 )
 
 // EksPodEipApplyReconciler reconciles a EksPodEipAssociation object
 type EksPodEipApplyReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	EC2      ec2api.EC2API
+	IPAM     *ipam.IPAddressManager
 }
 
-//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -43,17 +73,485 @@ type EksPodEipApplyReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.4/pkg/reconcile
 func (r *EksPodEipApplyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	logger := log.FromContext(ctx)
+
+	logger.V(1).Info(fmt.Sprintf("----------- association event received: %v\n", req))
+
+	var eipAssociation ekspodeipv1.EksPodEipAssociation
+	if err := r.Get(ctx, req.NamespacedName, &eipAssociation); err != nil {
+		if apierrors.IsNotFound(err) {
+			// ignore not-found error, the association has been deleted
+			return ctrl.Result{}, nil
+		}
+		logger.V(1).Error(err, fmt.Sprintf("unable to fetch EksPodEipAssociation %s: %v", req.NamespacedName, err))
+		return ctrl.Result{}, err
+	}
+
+	if !eipAssociation.DeletionTimestamp.IsZero() {
+		if !containsString(eipAssociation.Finalizers, associationFinalizerName) {
+			return ctrl.Result{}, nil
+		}
+
+		if eipAllocationID, err := r.revokeAssociation(&ctx, &logger, &eipAssociation); err != nil {
+			logger.V(1).Error(err, fmt.Sprintf(
+				"unable to revoke the aws EIP association %s", req.NamespacedName))
+
+			return ctrl.Result{}, err
+		} else if eipAllocationID != "" {
+			logger.V(1).Info(fmt.Sprintf(
+				"aws EIP %s of the association %s is released", eipAllocationID, req.NamespacedName))
+		}
+
+		// the EIP is not associated with the pod any more
+		eipAssociation.Status.Associated = false
+		if err := r.publishToPod(&ctx, &logger, &eipAssociation); err != nil {
+			logger.V(1).Error(err, fmt.Sprintf(
+				"unable to unpublish the aws EIP association %s from the pod", req.NamespacedName))
+
+			return ctrl.Result{}, err
+		}
+
+		// remove the finalizer from the association
+		eipAssociation.Finalizers = removeString(eipAssociation.Finalizers, associationFinalizerName)
+		if err := r.Update(ctx, &eipAssociation); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	// append the finalizer to the association if not exist
+	if !containsString(eipAssociation.Finalizers, associationFinalizerName) {
+		eipAssociation.Finalizers = append(eipAssociation.Finalizers, associationFinalizerName)
+		if err := r.Update(ctx, &eipAssociation); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	status := eipAssociation.Status.DeepCopy()
 
-	// TODO(user): your logic here
+	applyErr := r.applyAssociation(&ctx, &logger, &eipAssociation)
+
+	eipAssociation.Status.ObservedGeneration = eipAssociation.Generation
+	if !equality.Semantic.DeepEqual(status, &eipAssociation.Status) {
+		if err := r.Status().Update(ctx, &eipAssociation); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if applyErr != nil {
+		logger.V(1).Error(applyErr, fmt.Sprintf(
+			"unable to apply the aws EIP association %s", req.NamespacedName))
+
+		return ctrl.Result{}, applyErr
+	}
+
+	if err := r.publishToPod(&ctx, &logger, &eipAssociation); err != nil {
+		logger.V(1).Error(err, fmt.Sprintf(
+			"unable to publish the aws EIP association %s to the pod", req.NamespacedName))
+
+		return ctrl.Result{}, err
+	}
+
+	if !status.Associated && eipAssociation.Status.Associated {
+		logger.V(1).Info(fmt.Sprintf("aws EIP %s (%s) is associated with private IP %s of pod %s/%s",
+			eipAssociation.Status.ElasticIP, eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP,
+			eipAssociation.Spec.PodNamespace, eipAssociation.Spec.PodName))
+	}
 
 	return ctrl.Result{}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *EksPodEipApplyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.EC2 == nil {
+		return fmt.Errorf("ec2 client is not set")
+	}
+	if r.IPAM == nil {
+		return fmt.Errorf("ipam is not set")
+	}
+	if r.Recorder == nil {
+		return fmt.Errorf("event recorder is not set")
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		Named("eks-pod-eip-apply-controller").
 		For(&ekspodeipv1.EksPodEipAssociation{}).
+		Watches(
+			&source.Kind{Type: &ekspodeipv1.EksPodEipAssociation{}},
+			handler.EnqueueRequestsFromMapFunc(r.EipConflictingAssociationMapFunc)).
 		Complete(r)
 }
+
+// EipConflictingAssociationMapFunc enqueues the other associations claiming the same EIP.
+func (r *EksPodEipApplyReconciler) EipConflictingAssociationMapFunc(obj client.Object) []ctrl.Request {
+	eipAssociation, ok := obj.(*ekspodeipv1.EksPodEipAssociation)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer cancel()
+
+	logger := log.FromContext(ctx)
+
+	var requests []reconcile.Request
+	enqueued := map[string]bool{eipAssociation.Name: true}
+
+	for _, binding := range eipAssociation.Spec.Bindings() {
+		if binding.EipAllocationId == "" {
+			continue
+		}
+
+		var eipAssociations ekspodeipv1.EksPodEipAssociationList
+		if err := r.List(ctx, &eipAssociations,
+			client.MatchingFields{index.AssociationEipAllocationIdField: binding.EipAllocationId}); err != nil {
+			logger.V(1).Error(err, fmt.Sprintf(
+				"could not list EksPodEipAssociations of EIP %s: %v. the conflicted associations will not be reconciled.",
+				binding.EipAllocationId, err))
+			continue
+		}
+
+		for _, other := range eipAssociations.Items {
+			// the association is cluster scoped, the name is unique
+			if enqueued[other.Name] {
+				continue
+			}
+			enqueued[other.Name] = true
+
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: other.Namespace,
+				Name:      other.Name,
+			}})
+		}
+	}
+
+	return requests
+}
+
+// applyAssociation associates the EIP with the private IP of the pod.
+func (r *EksPodEipApplyReconciler) applyAssociation(
+	ctx *context.Context, logger *logr.Logger, eipAssociation *ekspodeipv1.EksPodEipAssociation) error {
+
+	// don't take the EIP from the pod claiming it before, the EIP would be reassociated back and forth
+	conflicting, err := eipConflictingAssociation(ctx, r, eipAssociation)
+	if err != nil {
+		return err
+	}
+	if conflicting != nil {
+		message := fmt.Sprintf("aws EIP %s is claimed by pod %s/%s in EksPodEipAssociation %s/%s already",
+			eipAssociation.Spec.EipAllocationId, conflicting.Spec.PodNamespace, conflicting.Spec.PodName,
+			conflicting.Namespace, conflicting.Name)
+
+		if !meta.IsStatusConditionTrue(eipAssociation.Status.Conditions, ekspodeipv1.EipAssociationConflicted) {
+			logger.V(1).Info(message)
+			r.Recorder.Event(eipAssociation, corev1.EventTypeWarning, reasonEipConflicted, message)
+		}
+
+		setAssociationConflicted(eipAssociation, message)
+		return nil
+	}
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationConflicted, metav1.ConditionFalse,
+		reasonNoConflict, fmt.Sprintf("aws EIP %s is not claimed by other pods", eipAssociation.Spec.EipAllocationId))
+
+	eipAssociation.Status.IPFamily = ipFamily(eipAssociation.Spec.PrivateIP)
+
+	eniId, err := getAwsEniId(r.EC2, eipAssociation.Spec.PrivateIP)
+	if err != nil {
+		err = fmt.Errorf("unable to get the aws ENI for private IP %s: %v", eipAssociation.Spec.PrivateIP, err)
+		setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+			awsConditionReason(err, reasonEniLookupError), err)
+		return err
+	}
+	if eniId == "" {
+		err = fmt.Errorf("no aws ENI found for private IP %s", eipAssociation.Spec.PrivateIP)
+		setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAssociated, reasonEniNotFound, err)
+		recordAssociationEvent(r.Recorder, eipAssociation, corev1.EventTypeWarning, reasonEniNotFound,
+			"No aws ENI found for private IP %s", eipAssociation.Spec.PrivateIP)
+		return err
+	}
+
+	eip, err := getAwsEip(r.EC2, eipAssociation.Spec.EipAllocationId)
+	if err != nil {
+		err = fmt.Errorf("unable to get the aws EIP %s: %v", eipAssociation.Spec.EipAllocationId, err)
+		setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAllocated,
+			awsConditionReason(err, reasonEipNotFound), err)
+		return err
+	}
+
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationAllocated, metav1.ConditionTrue,
+		reasonEipAllocated, fmt.Sprintf("aws EIP %s (%s) is allocated",
+			eipAssociation.Spec.EipAllocationId, aws.StringValue(eip.PublicIp)))
+
+	associationId := aws.StringValue(eip.AssociationId)
+
+	if aws.StringValue(eip.NetworkInterfaceId) != eniId ||
+		aws.StringValue(eip.PrivateIpAddress) != eipAssociation.Spec.PrivateIP {
+
+		logger.V(1).Info(fmt.Sprintf("associating aws EIP %s with private IP %s on ENI %s",
+			eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP, eniId))
+
+		associationId, err = associateAwsEip(
+			r.EC2, eipAssociation.Spec.EipAllocationId, eniId, eipAssociation.Spec.PrivateIP)
+		metrics.RecordEipAssociation(err)
+		if err != nil {
+			err = fmt.Errorf("unable to associate aws EIP %s with private IP %s on ENI %s: %v",
+				eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP, eniId, err)
+			setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+				awsConditionReason(err, reasonEipAssociateError), err)
+			return err
+		}
+
+		logger.V(1).Info(fmt.Sprintf("aws EIP %s associated with private IP %s on ENI %s, association id: %s",
+			eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP, eniId, associationId))
+
+		recordAssociationEvent(r.Recorder, eipAssociation, corev1.EventTypeNormal, reasonEipAssociated,
+			"EIP %s (%s) is associated with private IP %s on ENI %s", eipAssociation.Spec.EipAllocationId,
+			aws.StringValue(eip.PublicIp), eipAssociation.Spec.PrivateIP, eniId)
+
+		// the association is created once the pod IP is allocated
+		if eipAssociation.Status.AssociationId == "" {
+			metrics.ObserveEipAssociationLatency(time.Since(eipAssociation.CreationTimestamp.Time))
+		}
+	}
+
+	eipAssociation.Status.Associated = true
+	eipAssociation.Status.ElasticIP = aws.StringValue(eip.PublicIp)
+	eipAssociation.Status.AssociationId = associationId
+	eipAssociation.Status.NetworkInterfaceId = eniId
+
+	if err = r.applySecondaryBindings(logger, eipAssociation); err != nil {
+		return err
+	}
+
+	setAssociationApplied(eipAssociation, fmt.Sprintf("aws EIP %s (%s) is associated with private IP %s on ENI %s",
+		eipAssociation.Spec.EipAllocationId, eipAssociation.Status.ElasticIP, eipAssociation.Spec.PrivateIP, eniId))
+
+	return nil
+}
+
+// applySecondaryBindings associates the EIPs of the secondary bindings and records their status.
+func (r *EksPodEipApplyReconciler) applySecondaryBindings(
+	logger *logr.Logger, eipAssociation *ekspodeipv1.EksPodEipAssociation) error {
+
+	var bindingStatuses []ekspodeipv1.EipBindingStatus
+
+	for _, binding := range eipAssociation.Spec.SecondaryBindings {
+		eniId, err := getAwsEniId(r.EC2, binding.PrivateIP)
+		if err != nil {
+			err = fmt.Errorf("unable to get the aws ENI for private IP %s: %v", binding.PrivateIP, err)
+			setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+				awsConditionReason(err, reasonEniLookupError), err)
+			return err
+		}
+		if eniId == "" {
+			err = fmt.Errorf("no aws ENI found for private IP %s", binding.PrivateIP)
+			setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAssociated, reasonEniNotFound, err)
+			recordAssociationEvent(r.Recorder, eipAssociation, corev1.EventTypeWarning, reasonEniNotFound,
+				"No aws ENI found for private IP %s", binding.PrivateIP)
+			return err
+		}
+
+		eip, err := getAwsEip(r.EC2, binding.EipAllocationId)
+		if err != nil {
+			err = fmt.Errorf("unable to get the aws EIP %s: %v", binding.EipAllocationId, err)
+			setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAllocated,
+				awsConditionReason(err, reasonEipNotFound), err)
+			return err
+		}
+
+		associationId := aws.StringValue(eip.AssociationId)
+
+		if aws.StringValue(eip.NetworkInterfaceId) != eniId ||
+			aws.StringValue(eip.PrivateIpAddress) != binding.PrivateIP {
+
+			logger.V(1).Info(fmt.Sprintf("associating aws EIP %s with private IP %s on ENI %s",
+				binding.EipAllocationId, binding.PrivateIP, eniId))
+
+			associationId, err = associateAwsEip(r.EC2, binding.EipAllocationId, eniId, binding.PrivateIP)
+			metrics.RecordEipAssociation(err)
+			if err != nil {
+				err = fmt.Errorf("unable to associate aws EIP %s with private IP %s on ENI %s: %v",
+					binding.EipAllocationId, binding.PrivateIP, eniId, err)
+				setAssociationFailed(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+					awsConditionReason(err, reasonEipAssociateError), err)
+				return err
+			}
+
+			logger.V(1).Info(fmt.Sprintf("aws EIP %s associated with private IP %s on ENI %s, association id: %s",
+				binding.EipAllocationId, binding.PrivateIP, eniId, associationId))
+
+			recordAssociationEvent(r.Recorder, eipAssociation, corev1.EventTypeNormal, reasonEipAssociated,
+				"EIP %s (%s) is associated with private IP %s on ENI %s", binding.EipAllocationId,
+				aws.StringValue(eip.PublicIp), binding.PrivateIP, eniId)
+		}
+
+		bindingStatuses = append(bindingStatuses, ekspodeipv1.EipBindingStatus{
+			PrivateIP:          binding.PrivateIP,
+			Associated:         true,
+			ElasticIP:          aws.StringValue(eip.PublicIp),
+			AssociationId:      associationId,
+			NetworkInterfaceId: eniId,
+		})
+	}
+
+	eipAssociation.Status.SecondaryBindings = bindingStatuses
+
+	return nil
+}
+
+// revokeSecondaryBindings disassociates the EIPs of the secondary bindings.
+func (r *EksPodEipApplyReconciler) revokeSecondaryBindings(
+	logger *logr.Logger, eipAssociation *ekspodeipv1.EksPodEipAssociation) error {
+
+	for _, binding := range eipAssociation.Spec.SecondaryBindings {
+		eip, err := getAwsEip(r.EC2, binding.EipAllocationId)
+		if err != nil {
+			if awsErrorCode(err) == "InvalidAllocationID.NotFound" {
+				continue
+			}
+			return fmt.Errorf("unable to get the aws EIP %s: %v", binding.EipAllocationId, err)
+		}
+
+		if eip.AssociationId == nil || aws.StringValue(eip.PrivateIpAddress) != binding.PrivateIP {
+			continue
+		}
+
+		logger.V(1).Info(fmt.Sprintf("disassociating aws EIP %s from private IP %s",
+			binding.EipAllocationId, binding.PrivateIP))
+
+		if err = disassociateAwsEip(r.EC2, aws.StringValue(eip.AssociationId)); err != nil {
+			return fmt.Errorf("unable to disassociate aws EIP %s from private IP %s: %v",
+				binding.EipAllocationId, binding.PrivateIP, err)
+		}
+	}
+
+	eipAssociation.Status.SecondaryBindings = nil
+
+	return nil
+}
+
+func (r *EksPodEipApplyReconciler) revokeAssociation(
+	ctx *context.Context, logger *logr.Logger, eipAssociation *ekspodeipv1.EksPodEipAssociation) (string, error) {
+
+	if err := r.revokeSecondaryBindings(logger, eipAssociation); err != nil {
+		return "", err
+	}
+
+	eip, err := getAwsEip(r.EC2, eipAssociation.Spec.EipAllocationId)
+	if err != nil {
+		if awsErrorCode(err) == "InvalidAllocationID.NotFound" {
+			// the EIP has gone, nothing to disassociate or release
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to get the aws EIP %s: %v", eipAssociation.Spec.EipAllocationId, err)
+	}
+
+	// the EIP might be re-associated with another private IP by others, leave it as is
+	if eip.AssociationId != nil && aws.StringValue(eip.PrivateIpAddress) == eipAssociation.Spec.PrivateIP {
+		logger.V(1).Info(fmt.Sprintf("disassociating aws EIP %s from private IP %s",
+			eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP))
+
+		if err = disassociateAwsEip(r.EC2, aws.StringValue(eip.AssociationId)); err != nil {
+			return "", fmt.Errorf("unable to disassociate aws EIP %s from private IP %s: %v",
+				eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP, err)
+		}
+
+		logger.V(1).Info(fmt.Sprintf("aws EIP %s disassociated from private IP %s",
+			eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PrivateIP))
+	}
+
+	if retain, err := stickyEipRetained(ctx, r, eipAssociation.Spec.PodNamespace,
+		eipAssociation.Spec.StickyStatefulSet, eipAssociation.Spec.PodName); err != nil {
+		return "", fmt.Errorf("unable to check the sticky aws EIP %s: %v", eipAssociation.Spec.EipAllocationId, err)
+	} else if retain {
+		// the garbage collector ends the retention once the pod ordinal is gone
+		if err = r.IPAM.RetainEip(eipAssociation, eipAssociation.Spec.StickyStatefulSet); err != nil {
+			return "", fmt.Errorf("unable to retain aws EIP %s: %v", eipAssociation.Spec.EipAllocationId, err)
+		}
+
+		logger.V(1).Info(fmt.Sprintf("aws EIP %s is retained for the ordinal of StatefulSet %s/%s",
+			eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.PodNamespace,
+			eipAssociation.Spec.StickyStatefulSet))
+
+		metrics.RecordEipRelease(string(ekspodeipv1.EipReleasePolicyRetain))
+
+		return "", nil
+	}
+
+	eipAllocationId, err := r.IPAM.ReleaseEip(eipAssociation)
+	if err != nil {
+		return "", fmt.Errorf("unable to release aws EIP %s: %v", eipAssociation.Spec.EipAllocationId, err)
+	}
+	if eipAssociation.Spec.ManagedEip || eipAssociation.Spec.EipPool != "" {
+		metrics.RecordEipRelease(string(releasePolicy(&eipAssociation.Spec)))
+	}
+	if eipAllocationId != "" {
+		recordAssociationEvent(r.Recorder, eipAssociation, corev1.EventTypeNormal, reasonEipReleased,
+			"EIP %s is released", eipAllocationId)
+	}
+
+	return eipAllocationId, nil
+}
+
+// publishToPod writes the EIPs associated with the pod onto its annotations and label.
+func (r *EksPodEipApplyReconciler) publishToPod(
+	ctx *context.Context, logger *logr.Logger, eipAssociation *ekspodeipv1.EksPodEipAssociation) error {
+
+	ownerPod := associationPod(eipAssociation)
+	if ownerPod == nil {
+		return nil
+	}
+
+	var pod corev1.Pod
+	if err := r.Get(*ctx, client.ObjectKeyFromObject(ownerPod), &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to fetch Pod %s/%s: %v", ownerPod.Namespace, ownerPod.Name, err)
+	}
+	if pod.UID != ownerPod.UID {
+		// the pod is replaced by another one with the same name
+		return nil
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+
+	// the EIPs of the secondary bindings follow the one of the pod IP in the comma-separated lists
+	elasticIPs := []string{eipAssociation.Status.ElasticIP}
+	eipAllocationIds := []string{eipAssociation.Spec.EipAllocationId}
+	associationIds := []string{eipAssociation.Status.AssociationId}
+	for idx, bindingStatus := range eipAssociation.Status.SecondaryBindings {
+		if idx >= len(eipAssociation.Spec.SecondaryBindings) {
+			break
+		}
+		elasticIPs = append(elasticIPs, bindingStatus.ElasticIP)
+		eipAllocationIds = append(eipAllocationIds, eipAssociation.Spec.SecondaryBindings[idx].EipAllocationId)
+		associationIds = append(associationIds, bindingStatus.AssociationId)
+	}
+
+	values := map[string]string{
+		internal.PodEipAddressAnnotation:                strings.Join(elasticIPs, ","),
+		internal.PodEipAssociatedAllocationIdAnnotation: strings.Join(eipAllocationIds, ","),
+		internal.PodEipAssociationIdAnnotation:          strings.Join(associationIds, ","),
+	}
+
+	changed := false
+	for key, value := range values {
+		changed = setOrRemove(&pod.Annotations, key, value, eipAssociation.Status.Associated) || changed
+	}
+	changed = setOrRemove(&pod.Labels, internal.PodEipAddressLabel,
+		eipAssociation.Status.ElasticIP, eipAssociation.Status.Associated) || changed
+
+	if !changed {
+		return nil
+	}
+
+	logger.V(1).Info(fmt.Sprintf("updating the aws EIP of pod %s/%s", pod.Namespace, pod.Name))
+
+	if err := r.Patch(*ctx, &pod, patch); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to update Pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
+
+var _ = Describe("Publishing the EIP to the pod", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+	var logger logr.Logger
+	var eipAssociation *ekspodeipv1.EksPodEipAssociation
+
+	getPod := func() *corev1.Pod {
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		return &pod
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		logger = logr.Discard()
+
+		pod := newTestPod("ns", "pod-0", "10.0.0.1")
+		pod.Labels = map[string]string{"app": "edge"}
+		env = newFakeEnvironment(newTestNamespace("ns"), pod)
+
+		eipAssociation = &ekspodeipv1.EksPodEipAssociation{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "ns",
+				Name:      "eip-asso-ns-pod-0",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "v1", Kind: "Pod", Name: "pod-0", UID: pod.UID},
+				},
+			},
+			Spec: ekspodeipv1.EksPodEipAssociationSpec{
+				PodNamespace:    "ns",
+				PodName:         "pod-0",
+				PrivateIP:       "10.0.0.1",
+				EipAllocationId: "eipalloc-1",
+				SecondaryBindings: []ekspodeipv1.EipBinding{
+					{PrivateIP: "10.0.1.1", EipAllocationId: "eipalloc-2"},
+				},
+			},
+			Status: ekspodeipv1.EksPodEipAssociationStatus{
+				Associated:    true,
+				ElasticIP:     "203.0.113.1",
+				AssociationId: "eipassoc-1",
+				SecondaryBindings: []ekspodeipv1.EipBindingStatus{
+					{PrivateIP: "10.0.1.1", Associated: true, ElasticIP: "203.0.113.2", AssociationId: "eipassoc-2"},
+				},
+			},
+		}
+	})
+
+	It("writes the EIPs of the pod IP and the secondary private IPs in order", func() {
+		Expect(env.Apply.publishToPod(&ctx, &logger, eipAssociation)).To(Succeed())
+
+		pod := getPod()
+		Expect(pod.Annotations).To(Equal(map[string]string{
+			internal.PodEipAddressAnnotation:                "203.0.113.1,203.0.113.2",
+			internal.PodEipAssociatedAllocationIdAnnotation: "eipalloc-1,eipalloc-2",
+			internal.PodEipAssociationIdAnnotation:          "eipassoc-1,eipassoc-2",
+		}))
+		Expect(pod.Labels).To(Equal(map[string]string{
+			"app":                       "edge",
+			internal.PodEipAddressLabel: "203.0.113.1",
+		}))
+	})
+
+	It("removes the EIPs once the association is revoked", func() {
+		Expect(env.Apply.publishToPod(&ctx, &logger, eipAssociation)).To(Succeed())
+
+		eipAssociation.Status = ekspodeipv1.EksPodEipAssociationStatus{}
+		Expect(env.Apply.publishToPod(&ctx, &logger, eipAssociation)).To(Succeed())
+
+		pod := getPod()
+		Expect(pod.Annotations).To(BeEmpty())
+		Expect(pod.Labels).To(Equal(map[string]string{"app": "edge"}))
+	})
+
+	It("never triggers the assign controller by what it writes", func() {
+		oldPod := getPod()
+		Expect(env.Apply.publishToPod(&ctx, &logger, eipAssociation)).To(Succeed())
+
+		Expect(EipAssignPodPredicate{}.Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: getPod()})).
+			To(BeFalse())
+	})
+})
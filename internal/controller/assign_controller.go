@@ -23,40 +23,54 @@ import (
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
 	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/index"
 	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+	"github.com/zhiyanliu/eks-pod-eip/internal/metrics"
 )
 
 const (
-	finalizerName = "rp.amazonaws.com/eks-pod-eip-assign"
+	finalizerName = internal.PodEipFinalizer
 )
 
 type EksPodEipAssignReconciler struct {
 	client.Client
 	Scheme               *runtime.Scheme
+	Recorder             record.EventRecorder
 	IPAM                 *ipam.IPAddressManager
 	AssociationNamespace string
 	VpcId                string
+	StickyStatefulSetEip bool
+	EipReleasePolicy     ekspodeipv1.EipReleasePolicy
+	// ExcludedNamespaces are the glob patterns of the namespaces the EIP is never allocated to the pods in.
+	ExcludedNamespaces []string
 }
 
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=core,resources=pods/finalizers,verbs=update
 //+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=eippolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
-//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations,verbs=get;update;delete
+//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations,verbs=get;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -88,12 +102,49 @@ func (r *EksPodEipAssignReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
-	enabled := ns.GetLabels()[internal.NamespacePodEipAllocationEnabledLabel]
-	if enabled == "true" && pod.DeletionTimestamp.IsZero() {
+	policy, err := internal.PodEipPolicy(ctx, r, &pod, &ns)
+	if err != nil {
+		logger.V(1).Error(err, fmt.Sprintf("unable to fetch EipPolicy of pod %s: %v", req.NamespacedName, err))
+		return ctrl.Result{}, err
+	}
+
+	enabled := !internal.NamespaceExcluded(r.ExcludedNamespaces, pod.GetNamespace()) &&
+		internal.PodEipAllocationEnabled(&pod, &ns, policy)
+	if enabled && pod.Spec.HostNetwork {
+		// the pod IP is the primary IP of the node, the EIP would take over the public IP of the node
+		logger.V(1).Info(fmt.Sprintf("pod %s uses the host network, skipped", req.NamespacedName))
+		// the pod is marked skipped, the warning is recorded once rather than on every reconciliation
+		if pod.GetAnnotations()[internal.PodEipSkippedAnnotation] != reasonHostNetworkPod &&
+			pod.DeletionTimestamp.IsZero() {
+
+			patch := client.MergeFrom(pod.DeepCopy())
+			if pod.Annotations == nil {
+				pod.Annotations = map[string]string{}
+			}
+			pod.Annotations[internal.PodEipSkippedAnnotation] = reasonHostNetworkPod
+			if err := r.Patch(ctx, &pod, patch); err != nil {
+				logger.V(1).Error(err, fmt.Sprintf("unable to mark pod %s skipped: %v", req.NamespacedName, err))
+				return ctrl.Result{}, err
+			}
+
+			r.Recorder.Event(&pod, corev1.EventTypeWarning, reasonHostNetworkPod,
+				"EIP is not allocated to the host network pod, it would be associated with the node")
+		}
+		enabled = false
+	}
+	if enabled && pod.DeletionTimestamp.IsZero() {
 		if pod.Status.PodIP == "" {
 			// pod is not ready yet, wait the ip address is allocated to the pod
 			return ctrl.Result{}, nil
 		}
+		if ipam.PodIPv4(&pod) == "" {
+			// the EIP can't be associated with the IPv6 address
+			logger.V(1).Info(fmt.Sprintf("pod %s has no IPv4 address, skipped", req.NamespacedName))
+			r.Recorder.Eventf(&pod, corev1.EventTypeWarning, reasonIPv4NotFound,
+				"No IPv4 address found in pod IPs %s, the EIP can't be associated with the IPv6 address",
+				podIPs(&pod))
+			return ctrl.Result{}, nil
+		}
 
 		// append the finalizer to the pod if not exist
 		if !containsString(pod.Finalizers, finalizerName) {
@@ -103,7 +154,7 @@ func (r *EksPodEipAssignReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			}
 		}
 
-		if eipAllocationID, err := r.ensureAssociation(&ctx, &logger, &pod); err != nil {
+		if eipAllocationID, err := r.ensureAssociation(&ctx, &logger, &pod, &ns, policy); err != nil {
 			logger.V(1).Error(err, fmt.Sprintf(
 				"unable to ensure the aws EIP association for pod %s", req.NamespacedName))
 
@@ -113,7 +164,7 @@ func (r *EksPodEipAssignReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 				"pod %s is assigned with the aws EIP association %s", req.NamespacedName, eipAllocationID))
 		}
 	} else { // pod EIP allocation is disabled or the pod is being deleted
-		if eipAllocationID, err := r.releaseAssociation(&ctx, &logger, &pod); err != nil {
+		if eipAllocationID, err := r.releaseAssociation(&ctx, &logger, &pod, &ns, policy); err != nil {
 			logger.V(1).Error(err, fmt.Sprintf(
 				"unable to release the aws EIP association for pod %s", req.NamespacedName))
 
@@ -124,9 +175,11 @@ func (r *EksPodEipAssignReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		}
 
 		// remove the finalizer from the pod
-		pod.Finalizers = removeString(pod.Finalizers, finalizerName)
-		if err := r.Update(ctx, &pod); err != nil {
-			return ctrl.Result{}, err
+		if containsString(pod.Finalizers, finalizerName) {
+			pod.Finalizers = removeString(pod.Finalizers, finalizerName)
+			if err := r.Update(ctx, &pod); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 	}
 
@@ -138,8 +191,14 @@ func (r *EksPodEipAssignReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if r.IPAM == nil {
 		return fmt.Errorf("ipam is not set")
 	}
+	if r.Recorder == nil {
+		return fmt.Errorf("event recorder is not set")
+	}
 	if r.VpcId == "" {
-		panic("vpc id is empty")
+		return fmt.Errorf("vpc id is not set")
+	}
+	if r.EipReleasePolicy != "" && !isValidReleasePolicy(string(r.EipReleasePolicy)) {
+		return fmt.Errorf("invalid EIP release policy %s", r.EipReleasePolicy)
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
@@ -147,14 +206,100 @@ func (r *EksPodEipAssignReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(
 			&source.Kind{Type: &corev1.Pod{}},
 			&handler.EnqueueRequestForObject{},
-			builder.WithPredicates(EipAssignPodPredicate{})).
+			builder.WithPredicates(EipAssignPodPredicate{ExcludedNamespaces: r.ExcludedNamespaces})).
 		Watches(
 			&source.Kind{Type: &corev1.Namespace{}},
 			handler.EnqueueRequestsFromMapFunc(r.EipAssignNamespaceMapFunc),
-			builder.WithPredicates(EipAssignNamespacePredicate{})).
+			builder.WithPredicates(EipAssignNamespacePredicate{ExcludedNamespaces: r.ExcludedNamespaces})).
+		Watches(
+			&source.Kind{Type: &ekspodeipv1.EipPolicy{}},
+			r.eipPolicyEventHandler(),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
 
+// eipPolicyEventHandler enqueues the pods selected by the old or the new EipPolicy.
+func (r *EksPodEipAssignReconciler) eipPolicyEventHandler() handler.EventHandler {
+	enqueue := func(q workqueue.RateLimitingInterface, objs ...client.Object) {
+		enqueued := make(map[reconcile.Request]bool)
+		for _, obj := range objs {
+			for _, request := range r.EipPolicyMapFunc(obj) {
+				if enqueued[request] {
+					continue
+				}
+				enqueued[request] = true
+				q.Add(request)
+			}
+		}
+	}
+
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, e.Object)
+		},
+	}
+}
+
+// EipPolicyMapFunc maps the EipPolicy to the pods it selects.
+func (r *EksPodEipAssignReconciler) EipPolicyMapFunc(obj client.Object) []ctrl.Request {
+	policy, ok := obj.(*ekspodeipv1.EipPolicy)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer cancel()
+
+	logger := log.FromContext(ctx)
+
+	nsList := &corev1.NamespaceList{}
+	if err := r.List(ctx, nsList); err != nil {
+		logger.V(1).Error(err, fmt.Sprintf(
+			"could not list namespaces: %v. change to EipPolicy %s will not be reconciled.", err, policy.Name))
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, ns := range nsList.Items {
+		if internal.NamespaceExcluded(r.ExcludedNamespaces, ns.Name) {
+			continue
+		}
+
+		podList := &corev1.PodList{}
+		if err := r.List(ctx, podList,
+			client.InNamespace(ns.Name), client.MatchingFields{index.PodEipCandidateField: "true"}); err != nil {
+			logger.V(1).Error(err, fmt.Sprintf(
+				"could not list pod in namespace %s: %v. change to EipPolicy %s will not be reconciled.",
+				ns.Name, err, policy.Name))
+			return nil
+		}
+
+		for idx := range podList.Items {
+			pod := &podList.Items[idx]
+			if !internal.EipPolicySelects(policy, pod, &ns) {
+				continue
+			}
+
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+			}})
+		}
+	}
+
+	return requests
+}
+
 func (r *EksPodEipAssignReconciler) EipAssignNamespaceMapFunc(obj client.Object) []ctrl.Request {
 	ns, ok := obj.(*corev1.Namespace)
 	if !ok {
@@ -166,8 +311,13 @@ func (r *EksPodEipAssignReconciler) EipAssignNamespaceMapFunc(obj client.Object)
 
 	logger := log.FromContext(ctx)
 
+	if internal.NamespaceExcluded(r.ExcludedNamespaces, ns.Name) {
+		return nil
+	}
+
+	// only the pods might be associated or holding the association are concerned by the namespace change
 	podList := &corev1.PodList{}
-	err := r.List(ctx, podList, client.InNamespace(ns.Name))
+	err := r.List(ctx, podList, client.InNamespace(ns.Name), client.MatchingFields{index.PodEipCandidateField: "true"})
 	if err != nil {
 		logger.V(1).Error(err, fmt.Sprintf(
 			"could not list pod in namespace %s: %v. change to Namespace %s will not be reconciled.",
@@ -200,8 +350,47 @@ func (r *EksPodEipAssignReconciler) eipAssociationName(pod *corev1.Pod) string {
 	return fmt.Sprintf("eip-asso-%s-%s", pod.GetNamespace(), pod.GetName())
 }
 
+// eipStickyStatefulSet returns the StatefulSet owning the pod if its EIP is sticky to the ordinal.
+func (r *EksPodEipAssignReconciler) eipStickyStatefulSet(pod *corev1.Pod) string {
+	sticky := r.StickyStatefulSetEip
+	if value, exists := pod.GetAnnotations()[internal.PodEipStickyAnnotation]; exists {
+		sticky = value == "true"
+	}
+	if !sticky {
+		return ""
+	}
+
+	statefulSet, _, ok := statefulSetOrdinal(pod)
+	if !ok {
+		return ""
+	}
+
+	return statefulSet
+}
+
+// eipReleasePolicy returns the release policy of the EIP of the pod.
+func (r *EksPodEipAssignReconciler) eipReleasePolicy(
+	pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy) ekspodeipv1.EipReleasePolicy {
+
+	if value, exists := pod.GetAnnotations()[internal.PodEipReleasePolicyAnnotation]; exists && isValidReleasePolicy(value) {
+		return ekspodeipv1.EipReleasePolicy(value)
+	}
+	if policy != nil && policy.Spec.ReleasePolicy != "" {
+		return policy.Spec.ReleasePolicy
+	}
+	if value, exists := ns.GetLabels()[internal.NamespacePodEipReleasePolicyLabel]; exists && isValidReleasePolicy(value) {
+		return ekspodeipv1.EipReleasePolicy(value)
+	}
+	if r.EipReleasePolicy != "" {
+		return r.EipReleasePolicy
+	}
+
+	return ekspodeipv1.EipReleasePolicyDelete
+}
+
 func (r *EksPodEipAssignReconciler) ensureAssociation(
-	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod) (string, error) {
+	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod, ns *corev1.Namespace,
+	policy *ekspodeipv1.EipPolicy) (string, error) {
 
 	if pod == nil {
 		return "", fmt.Errorf("pod is nil")
@@ -211,8 +400,13 @@ func (r *EksPodEipAssignReconciler) ensureAssociation(
 	if err := r.Get(
 		*ctx,
 		types.NamespacedName{Name: r.eipAssociationName(pod), Namespace: r.eipAssociationNamespace(pod)},
-		&eipAssociation); err == nil { // the association resource exists, need to delete it first
-		logger.V(1).Info(fmt.Sprintf("EksPodEipAssociation %s/%s already exists, delete it first",
+		&eipAssociation); err == nil { // the association resource exists
+		if eipAssociation.DeletionTimestamp.IsZero() && !r.associationOutdated(pod, ns, policy, &eipAssociation) {
+			return r.updateAssociation(ctx, logger, pod, ns, policy, &eipAssociation)
+		}
+
+		// the EIP of the pod is changed or the association is of the previous pod, need to delete it first
+		logger.V(1).Info(fmt.Sprintf("EksPodEipAssociation %s/%s is outdated, delete it first",
 			r.eipAssociationNamespace(pod), r.eipAssociationName(pod)))
 
 		if err = r.deleteAssociation(ctx, logger, &eipAssociation); err != nil {
@@ -221,6 +415,12 @@ func (r *EksPodEipAssignReconciler) ensureAssociation(
 
 			return "", err
 		}
+
+		if len(eipAssociation.Finalizers) > 0 {
+			// the EIP is being disassociated, create the association after the old one has gone
+			return "", fmt.Errorf("EksPodEipAssociation %s/%s is being deleted, retry later",
+				eipAssociation.Namespace, eipAssociation.Name)
+		}
 	} else if !apierrors.IsNotFound(err) { // error happens
 		logger.V(1).Error(err, fmt.Sprintf("unable to fetch EksPodEipAssociation %s/%s: %v",
 			r.eipAssociationNamespace(pod), r.eipAssociationName(pod), err))
@@ -230,30 +430,119 @@ func (r *EksPodEipAssignReconciler) ensureAssociation(
 	}
 
 	// create the association resource
-	newEipAssociation, err := r.createAssociation(ctx, logger, pod)
+	newEipAssociation, err := r.createAssociation(ctx, logger, pod, ns, policy)
 	if err != nil {
 		logger.V(1).Error(err, fmt.Sprintf("unable to create EksPodEipAssociation %s/%s",
-			newEipAssociation.Namespace, newEipAssociation.Name))
+			r.eipAssociationNamespace(pod), r.eipAssociationName(pod)))
 
 		return "", fmt.Errorf("unable to create EksPodEipAssociation %s/%s: %v",
-			newEipAssociation.Namespace, newEipAssociation.Name, err)
+			r.eipAssociationNamespace(pod), r.eipAssociationName(pod), err)
 	}
 
 	return newEipAssociation.Spec.EipAllocationId, nil
 }
 
 func (r *EksPodEipAssignReconciler) releaseAssociation(
-	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod) (string, error) {
+	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod, ns *corev1.Namespace,
+	policy *ekspodeipv1.EipPolicy) (string, error) {
 
 	if pod == nil {
 		return "", fmt.Errorf("pod is nil")
 	}
 
-	return "", nil
+	var eipAssociation ekspodeipv1.EksPodEipAssociation
+	if err := r.Get(
+		*ctx,
+		types.NamespacedName{Name: r.eipAssociationName(pod), Namespace: r.eipAssociationNamespace(pod)},
+		&eipAssociation); err != nil {
+		if apierrors.IsNotFound(err) {
+			if !pod.DeletionTimestamp.IsZero() {
+				// the pod is deleted before the EIP reserved at the admission is associated
+				return r.releaseReservation(logger, pod, ns, policy)
+			}
+			return "", nil // nothing to release
+		}
+
+		return "", fmt.Errorf("unable to fetch EksPodEipAssociation %s/%s: %v",
+			r.eipAssociationNamespace(pod), r.eipAssociationName(pod), err)
+	}
+
+	// the EIP is disassociated and released by the finalizer of the association
+	if err := r.deleteAssociation(ctx, logger, &eipAssociation); err != nil {
+		return "", err
+	}
+
+	// the reservation is claimed by the association, the EIP is not reserved for the pod any more
+	if err := r.removeReservation(ctx, logger, pod); err != nil {
+		return "", err
+	}
+
+	return eipAssociation.Spec.EipAllocationId, nil
+}
+
+// removeReservation removes the reservation annotations from the pod.
+func (r *EksPodEipAssignReconciler) removeReservation(
+	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod) error {
+
+	if pod.GetAnnotations()[internal.PodEipReservedAnnotation] != "true" {
+		return nil
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	delete(pod.Annotations, internal.PodEipReservedAnnotation)
+	delete(pod.Annotations, internal.PodEipReservationTokenAnnotation)
+	delete(pod.Annotations, internal.PodEipAllocationIdAnnotation)
+	if err := r.Patch(*ctx, pod, patch); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to remove the reservation from pod %s/%s: %v",
+			pod.GetNamespace(), pod.GetName(), err)
+	}
+
+	logger.V(1).Info(fmt.Sprintf("reservation removed from pod %s/%s", pod.GetNamespace(), pod.GetName()))
+
+	return nil
 }
 
-func (r *EksPodEipAssignReconciler) createAssociation(
-	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod) (*ekspodeipv1.EksPodEipAssociation, error) {
+// releaseReservation releases the EIP reserved for the pod but never associated.
+func (r *EksPodEipAssignReconciler) releaseReservation(
+	logger *logr.Logger, pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy) (string, error) {
+
+	eipAllocationId, exists := pod.GetAnnotations()[internal.PodEipAllocationIdAnnotation]
+	if !exists || pod.GetAnnotations()[internal.PodEipReservedAnnotation] != "true" {
+		return "", nil
+	}
+
+	pool := ipam.PodEipPool(pod, ns, policy)
+
+	// the association is never created, release the EIP the same as the association finalizer does
+	var eipAssociation ekspodeipv1.EksPodEipAssociation
+	eipAssociation.Spec = ekspodeipv1.EksPodEipAssociationSpec{
+		PodNamespace:    pod.GetNamespace(),
+		PodName:         pod.GetName(),
+		EipAllocationId: eipAllocationId,
+		EipPool:         pool,
+		ManagedEip:      pool == "",
+		ReleasePolicy:   r.eipReleasePolicy(pod, ns, policy),
+	}
+
+	logger.V(1).Info(fmt.Sprintf("releasing EIP %s reserved for pod %s/%s",
+		eipAllocationId, pod.GetNamespace(), pod.GetName()))
+
+	released, err := r.IPAM.ReleaseReservedEip(pod, &eipAssociation)
+	if err != nil {
+		return "", fmt.Errorf("unable to release EIP %s reserved for pod %s/%s: %v",
+			eipAllocationId, pod.GetNamespace(), pod.GetName(), err)
+	}
+	if released != "" {
+		metrics.RecordEipRelease(string(releasePolicy(&eipAssociation.Spec)))
+		r.Recorder.Eventf(pod, corev1.EventTypeNormal, reasonEipReleased,
+			"EIP %s reserved for the pod is released", released)
+	}
+
+	return eipAllocationId, nil
+}
+
+func (r *EksPodEipAssignReconciler) createAssociation(ctx *context.Context, logger *logr.Logger,
+	pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy) (*ekspodeipv1.EksPodEipAssociation, error) {
 
 	var eipAssociation ekspodeipv1.EksPodEipAssociation
 
@@ -262,20 +551,51 @@ func (r *EksPodEipAssignReconciler) createAssociation(
 	eipAssociation.Spec = ekspodeipv1.EksPodEipAssociationSpec{
 		PodNamespace: pod.GetNamespace(),
 		PodName:      pod.GetName(),
-		PrivateIP:    pod.Status.PodIP,
+		PrivateIP:    ipam.PodIPv4(pod),
+		Fargate:      podOnFargate(pod),
 	}
 
 	// allocate an EIP
-	if eipAllocationId, err := r.IPAM.AllocateEip(pod); err != nil {
+	eipAssociation.Spec.EipPool = ipam.PodEipPool(pod, ns, policy)
+	eipAssociation.Spec.StickyStatefulSet = r.eipStickyStatefulSet(pod)
+	eipAssociation.Spec.ReleasePolicy = r.eipReleasePolicy(pod, ns, policy)
+	if eipAllocationId, managed, err := r.IPAM.AllocateEip(
+		pod, eipAssociation.Spec.EipPool, eipAssociation.Name); err != nil {
+		metrics.RecordEipAllocation(allocationSource(&eipAssociation.Spec), err)
+		r.Recorder.Eventf(pod, corev1.EventTypeWarning, reasonEipAllocationFailed,
+			"Unable to allocate EIP: %v", err)
+
 		return nil, fmt.Errorf("unable to allocate EIP for pod %s/%s: %v",
 			pod.GetNamespace(), pod.GetName(), err)
 	} else {
 		eipAssociation.Spec.EipAllocationId = eipAllocationId
+		eipAssociation.Spec.ManagedEip = managed
+		metrics.RecordEipAllocation(allocationSource(&eipAssociation.Spec), nil)
+	}
+
+	// bind the EIPs beyond the first one with the secondary private IPs of the pod
+	if err := r.bindSecondaryEips(logger, pod, &eipAssociation); err != nil {
+		return nil, err
+	}
+
+	// the apply controller marks the association conflicted if another pod claims the EIP
+	if !eipAssociation.Spec.ManagedEip && eipAssociation.Spec.EipPool == "" {
+		if conflicting, err := eipConflictingAssociation(ctx, r, &eipAssociation); err != nil {
+			return nil, err
+		} else if conflicting != nil {
+			logger.V(1).Info(fmt.Sprintf("aws EIP %s of pod %s/%s is claimed by pod %s/%s already",
+				eipAssociation.Spec.EipAllocationId, pod.GetNamespace(), pod.GetName(),
+				conflicting.Spec.PodNamespace, conflicting.Spec.PodName))
+
+			r.Recorder.Eventf(pod, corev1.EventTypeWarning, reasonEipConflicted,
+				"EIP %s is claimed by pod %s/%s already", eipAssociation.Spec.EipAllocationId,
+				conflicting.Spec.PodNamespace, conflicting.Spec.PodName)
+		}
 	}
 
 	ownerRef := metav1.OwnerReference{
-		APIVersion: pod.APIVersion,
-		Kind:       pod.Kind,
+		APIVersion: corev1.SchemeGroupVersion.String(),
+		Kind:       "Pod",
 		Name:       pod.Name,
 		UID:        pod.UID,
 		Controller: new(bool), // false
@@ -289,15 +609,143 @@ func (r *EksPodEipAssignReconciler) createAssociation(
 		return nil, err
 	}
 
+	switch {
+	case eipAssociation.Spec.EipPool != "":
+		recordAssociationEvent(r.Recorder, &eipAssociation, corev1.EventTypeNormal, reasonEipAllocated,
+			"EIP %s is drawn from EipPool %s", eipAssociation.Spec.EipAllocationId, eipAssociation.Spec.EipPool)
+	case eipAssociation.Spec.ManagedEip:
+		recordAssociationEvent(r.Recorder, &eipAssociation, corev1.EventTypeNormal, reasonEipAllocated,
+			"EIP %s is allocated by the controller", eipAssociation.Spec.EipAllocationId)
+	default:
+		recordAssociationEvent(r.Recorder, &eipAssociation, corev1.EventTypeNormal, reasonEipAllocated,
+			"EIP %s is specified by the pod annotation", eipAssociation.Spec.EipAllocationId)
+	}
+
 	logger.V(1).Info(fmt.Sprintf("EksPodEipAssociation %s/%s created",
 		r.eipAssociationNamespace(pod), r.eipAssociationName(pod)))
 
 	return &eipAssociation, nil
 }
 
-func (r *EksPodEipAssignReconciler) updateAssociation(
-	ctx *context.Context, logger *logr.Logger, pod *corev1.Pod, eipAllocationId string) (string, error) {
-	return "", nil
+// bindSecondaryEips binds an EIP to each secondary private IP of the pod in order.
+func (r *EksPodEipAssignReconciler) bindSecondaryEips(
+	logger *logr.Logger, pod *corev1.Pod, eipAssociation *ekspodeipv1.EksPodEipAssociation) error {
+
+	preferredEipAllocationIds := ipam.PodEipAllocationIds(pod)
+	secondaryIPs := podSecondaryIPs(pod)
+	userEip := !eipAssociation.Spec.ManagedEip && eipAssociation.Spec.EipPool == ""
+
+	count := secondaryEipCount(pod, &eipAssociation.Spec)
+	if requested := podEipCount(pod, preferredEipAllocationIds) - 1; !userEip && requested > count {
+		logger.V(1).Info(fmt.Sprintf("pod %s/%s requests %d secondary EIPs but has %d secondary private IPs",
+			pod.GetNamespace(), pod.GetName(), requested, len(secondaryIPs)))
+	}
+	if count < 1 {
+		return nil
+	}
+
+	for idx, privateIP := range secondaryIPs[:count] {
+		binding := ekspodeipv1.EipBinding{PrivateIP: privateIP}
+
+		if userEip {
+			binding.EipAllocationId = preferredEipAllocationIds[idx+1]
+		} else {
+			eipAllocationId, err := r.IPAM.AllocateSecondaryEip(
+				pod, eipAssociation.Spec.EipPool, eipAssociation.Name, privateIP)
+			metrics.RecordEipAllocation(allocationSource(&eipAssociation.Spec), err)
+			if err != nil {
+				r.Recorder.Eventf(pod, corev1.EventTypeWarning, reasonEipAllocationFailed,
+					"Unable to allocate EIP for secondary private IP %s: %v", privateIP, err)
+
+				return fmt.Errorf("unable to allocate EIP for secondary private IP %s of pod %s/%s: %v",
+					privateIP, pod.GetNamespace(), pod.GetName(), err)
+			}
+			binding.EipAllocationId = eipAllocationId
+		}
+
+		eipAssociation.Spec.SecondaryBindings = append(eipAssociation.Spec.SecondaryBindings, binding)
+	}
+
+	return nil
+}
+
+// updateAssociation patches the fields of the association differing from the pod, the EIP is kept.
+func (r *EksPodEipAssignReconciler) updateAssociation(ctx *context.Context, logger *logr.Logger,
+	pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy,
+	eipAssociation *ekspodeipv1.EksPodEipAssociation) (string, error) {
+
+	spec := eipAssociation.Spec.DeepCopy()
+	spec.PrivateIP = ipam.PodIPv4(pod)
+	// the count of the bindings is checked by associationOutdated
+	secondaryIPs := podSecondaryIPs(pod)
+	for idx := range spec.SecondaryBindings {
+		if idx < len(secondaryIPs) {
+			spec.SecondaryBindings[idx].PrivateIP = secondaryIPs[idx]
+		}
+	}
+	spec.StickyStatefulSet = r.eipStickyStatefulSet(pod)
+	spec.ReleasePolicy = r.eipReleasePolicy(pod, ns, policy)
+
+	if equality.Semantic.DeepEqual(spec, &eipAssociation.Spec) {
+		return eipAssociation.Spec.EipAllocationId, nil
+	}
+
+	logger.V(1).Info(fmt.Sprintf("updating EksPodEipAssociation %s/%s",
+		eipAssociation.GetNamespace(), eipAssociation.GetName()))
+
+	patch := client.MergeFrom(eipAssociation.DeepCopy())
+	eipAssociation.Spec = *spec
+	if err := r.Patch(*ctx, eipAssociation, patch); err != nil {
+		return "", fmt.Errorf("unable to update EksPodEipAssociation %s/%s: %v",
+			eipAssociation.GetNamespace(), eipAssociation.GetName(), err)
+	}
+
+	logger.V(1).Info(fmt.Sprintf("EksPodEipAssociation %s/%s updated",
+		eipAssociation.GetNamespace(), eipAssociation.GetName()))
+
+	return eipAssociation.Spec.EipAllocationId, nil
+}
+
+// associationOutdated checks if the association needs to be recreated for the pod.
+func (r *EksPodEipAssignReconciler) associationOutdated(
+	pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy,
+	eipAssociation *ekspodeipv1.EksPodEipAssociation) bool {
+
+	ownedByPod := false
+	for _, ownerRef := range eipAssociation.OwnerReferences {
+		if ownerRef.UID == pod.UID {
+			ownedByPod = true
+			break
+		}
+	}
+	if !ownedByPod {
+		return true
+	}
+
+	// the secondary bindings are immutable, the pod gets or loses the secondary private IPs or EIPs
+	if secondaryEipCount(pod, &eipAssociation.Spec) != len(eipAssociation.Spec.SecondaryBindings) {
+		return true
+	}
+
+	if eipAllocationIds := ipam.PodEipAllocationIds(pod); len(eipAllocationIds) > 0 {
+		if eipAllocationIds[0] != eipAssociation.Spec.EipAllocationId {
+			return true
+		}
+		// the EIPs of the secondary private IPs specified are changed
+		for idx, binding := range eipAssociation.Spec.SecondaryBindings {
+			if idx+1 < len(eipAllocationIds) && eipAllocationIds[idx+1] != binding.EipAllocationId {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the EIP specified by the user is removed from the pod
+	if !eipAssociation.Spec.ManagedEip && eipAssociation.Spec.EipPool == "" {
+		return true
+	}
+
+	return eipAssociation.Spec.EipPool != ipam.PodEipPool(pod, ns, policy)
 }
 
 func (r *EksPodEipAssignReconciler) deleteAssociation(
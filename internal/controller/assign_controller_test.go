@@ -0,0 +1,396 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
+
+func newTestNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{internal.NamespacePodEipAllocationEnabledLabel: "true"},
+		},
+	}
+}
+
+func newTestPod(namespace, name, podIP string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(name + "-uid")},
+		Status: corev1.PodStatus{
+			PodIP:  podIP,
+			PodIPs: []corev1.PodIP{{IP: podIP}},
+		},
+	}
+}
+
+var _ = Describe("EksPodEipAssignReconciler", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = newFakeEnvironment(newTestNamespace("ns"), newTestPod("ns", "pod-0", "10.0.0.1"))
+		env.EC2.AddNetworkInterface("eni-0", testVpcId, "10.0.0.1")
+	})
+
+	It("associates the EIP with the pod and releases it after the pod is deleted", func() {
+		By("creating the association of the pod")
+		env.reconcilePod("ns", "pod-0")
+
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		Expect(pod.Finalizers).To(ContainElement(finalizerName))
+
+		var eipAssociation ekspodeipv1.EksPodEipAssociation
+		associationKey := types.NamespacedName{Namespace: "ns", Name: "eip-asso-ns-pod-0"}
+		Expect(env.Client.Get(ctx, associationKey, &eipAssociation)).To(Succeed())
+		Expect(eipAssociation.Spec.PrivateIP).To(Equal("10.0.0.1"))
+		Expect(eipAssociation.Spec.ManagedEip).To(BeTrue())
+
+		addresses := env.EC2.Addresses()
+		Expect(addresses).To(HaveLen(1))
+		Expect(aws.StringValue(addresses[0].AllocationId)).To(Equal(eipAssociation.Spec.EipAllocationId))
+		Expect(addresses[0].Tags).To(ContainElement(HaveField("Key", HaveValue(Equal(internal.EipClusterNameTag)))))
+		Expect(addresses[0].AssociationId).To(BeNil())
+
+		By("associating the EIP in EC2")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-0")
+
+		addresses = env.EC2.Addresses()
+		Expect(addresses).To(HaveLen(1))
+		Expect(aws.StringValue(addresses[0].NetworkInterfaceId)).To(Equal("eni-0"))
+		Expect(aws.StringValue(addresses[0].PrivateIpAddress)).To(Equal("10.0.0.1"))
+
+		Expect(env.Client.Get(ctx, associationKey, &eipAssociation)).To(Succeed())
+		Expect(eipAssociation.Finalizers).To(ContainElement(associationFinalizerName))
+		Expect(eipAssociation.Status.Associated).To(BeTrue())
+		Expect(eipAssociation.Status.AssociationId).To(Equal(aws.StringValue(addresses[0].AssociationId)))
+
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		Expect(pod.Annotations).To(HaveKeyWithValue(internal.PodEipAddressAnnotation,
+			aws.StringValue(addresses[0].PublicIp)))
+		Expect(pod.Labels).To(HaveKeyWithValue(internal.PodEipAddressLabel, aws.StringValue(addresses[0].PublicIp)))
+
+		By("deleting the pod")
+		Expect(env.Client.Delete(ctx, &pod)).To(Succeed())
+		env.reconcilePod("ns", "pod-0")
+
+		err := env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		Expect(env.Client.Get(ctx, associationKey, &eipAssociation)).To(Succeed())
+		Expect(eipAssociation.DeletionTimestamp.IsZero()).To(BeFalse())
+
+		By("disassociating and releasing the EIP in EC2")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-0")
+
+		Expect(env.EC2.Addresses()).To(BeEmpty())
+
+		err = env.Client.Get(ctx, associationKey, &eipAssociation)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		tracked, err := env.IPAM.TrackedEipAllocationIds()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tracked).To(BeEmpty())
+	})
+
+	It("keeps the EIP specified by the user after the pod is deleted", func() {
+		output, err := env.EC2.AllocateAddress(&ec2.AllocateAddressInput{Domain: aws.String("vpc")})
+		Expect(err).NotTo(HaveOccurred())
+		eipAllocationId := aws.StringValue(output.AllocationId)
+
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		pod.Annotations = map[string]string{internal.PodEipAllocationIdAnnotation: eipAllocationId}
+		Expect(env.Client.Update(ctx, &pod)).To(Succeed())
+
+		env.reconcilePod("ns", "pod-0")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-0")
+
+		addresses := env.EC2.Addresses()
+		Expect(addresses).To(HaveLen(1))
+		Expect(aws.StringValue(addresses[0].PrivateIpAddress)).To(Equal("10.0.0.1"))
+
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		Expect(env.Client.Delete(ctx, &pod)).To(Succeed())
+		env.reconcilePod("ns", "pod-0")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-0")
+
+		addresses = env.EC2.Addresses()
+		Expect(addresses).To(HaveLen(1))
+		Expect(aws.StringValue(addresses[0].AllocationId)).To(Equal(eipAllocationId))
+		Expect(addresses[0].AssociationId).To(BeNil())
+	})
+})
+
+var _ = Describe("EIP reserved at the admission", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+
+	getPod := func() *corev1.Pod {
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		return &pod
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = newFakeEnvironment(newTestNamespace("ns"))
+
+		pod := newTestPod("ns", "pod-0", "10.0.0.1")
+		pod.Annotations = map[string]string{internal.PodEipReservationTokenAnnotation: "token-a"}
+		eipAllocationId, err := env.IPAM.ReserveEip(pod, "")
+		Expect(err).NotTo(HaveOccurred())
+		pod.Annotations[internal.PodEipReservedAnnotation] = "true"
+		pod.Annotations[internal.PodEipAllocationIdAnnotation] = eipAllocationId
+		Expect(env.Client.Create(ctx, pod)).To(Succeed())
+
+		env.reconcilePod("ns", "pod-0")
+	})
+
+	It("removes the reservation from the pod opting out", func() {
+		pod := getPod()
+		// the reservation is removed regardless of the finalizer
+		pod.Finalizers = nil
+		pod.Labels = map[string]string{internal.PodEipAllocationEnabledLabel: "false"}
+		Expect(env.Client.Update(ctx, pod)).To(Succeed())
+
+		env.reconcilePod("ns", "pod-0")
+
+		Expect(getPod().Annotations).NotTo(HaveKey(internal.PodEipReservedAnnotation))
+		Expect(getPod().Annotations).NotTo(HaveKey(internal.PodEipReservationTokenAnnotation))
+		Expect(getPod().Annotations).NotTo(HaveKey(internal.PodEipAllocationIdAnnotation))
+	})
+})
+
+var _ = Describe("Pods with their own networking", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = newFakeEnvironment(newTestNamespace("ns"))
+	})
+
+	It("associates the EIP with the ENI dedicated to the Fargate pod", func() {
+		pod := newTestPod("ns", "pod-0", "10.0.0.9")
+		pod.Labels = map[string]string{internal.PodFargateProfileLabel: "default"}
+		Expect(env.Client.Create(ctx, pod)).To(Succeed())
+		// the pod IP is the primary private IP of the ENI on Fargate
+		env.EC2.AddNetworkInterface("eni-node", testVpcId, "10.0.0.1", "10.0.0.2")
+		env.EC2.AddNetworkInterface("eni-fargate", testVpcId, "10.0.0.9")
+
+		env.reconcilePod("ns", "pod-0")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-0")
+
+		addresses := env.EC2.Addresses()
+		Expect(addresses).To(HaveLen(1))
+		Expect(aws.StringValue(addresses[0].NetworkInterfaceId)).To(Equal("eni-fargate"))
+		Expect(aws.StringValue(addresses[0].PrivateIpAddress)).To(Equal("10.0.0.9"))
+	})
+
+	It("warns once that the host network pod is skipped", func() {
+		pod := newTestPod("ns", "pod-0", "10.0.0.1")
+		pod.Spec.HostNetwork = true
+		Expect(env.Client.Create(ctx, pod)).To(Succeed())
+
+		for i := 0; i < 3; i++ {
+			env.reconcilePod("ns", "pod-0")
+		}
+
+		Expect(countEvents(env.events(), reasonHostNetworkPod)).To(Equal(1))
+		Expect(env.EC2.Addresses()).To(BeEmpty())
+
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, pod)).To(Succeed())
+		Expect(pod.Annotations).To(HaveKeyWithValue(internal.PodEipSkippedAnnotation, reasonHostNetworkPod))
+		Expect(pod.Finalizers).NotTo(ContainElement(finalizerName))
+	})
+})
+
+var _ = Describe("Secondary bindings", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+
+	associationKey := types.NamespacedName{Namespace: "ns", Name: "eip-asso-ns-pod-0"}
+
+	annotate := func(annotations map[string]string) {
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-0"}, &pod)).To(Succeed())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			pod.Annotations[key] = value
+		}
+		Expect(env.Client.Update(ctx, &pod)).To(Succeed())
+	}
+
+	networkStatus := func(ips ...string) string {
+		return `[{"name":"aws-cni","ips":["10.0.0.1"],"default":true},{"name":"ns/net1","ips":["` +
+			strings.Join(ips, `","`) + `"]}]`
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = newFakeEnvironment(newTestNamespace("ns"), newTestPod("ns", "pod-0", "10.0.0.1"))
+		annotate(map[string]string{
+			internal.PodEipCountAnnotation:      "2",
+			internal.PodNetworkStatusAnnotation: networkStatus("10.0.1.1", "10.0.1.2"),
+		})
+		env.reconcilePod("ns", "pod-0")
+	})
+
+	It("follows the secondary private IPs of the pod and keeps the EIP", func() {
+		var eipAssociation ekspodeipv1.EksPodEipAssociation
+		Expect(env.Client.Get(ctx, associationKey, &eipAssociation)).To(Succeed())
+		Expect(eipAssociation.Spec.SecondaryBindings).To(HaveLen(1))
+		Expect(eipAssociation.Spec.SecondaryBindings[0].PrivateIP).To(Equal("10.0.1.1"))
+		eipAllocationId := eipAssociation.Spec.SecondaryBindings[0].EipAllocationId
+
+		annotate(map[string]string{internal.PodNetworkStatusAnnotation: networkStatus("10.0.1.5")})
+		env.reconcilePod("ns", "pod-0")
+
+		Expect(env.Client.Get(ctx, associationKey, &eipAssociation)).To(Succeed())
+		Expect(eipAssociation.Spec.SecondaryBindings).To(ConsistOf(ekspodeipv1.EipBinding{
+			PrivateIP:       "10.0.1.5",
+			EipAllocationId: eipAllocationId,
+		}))
+	})
+
+	It("recreates the association when the pod requests more EIPs", func() {
+		annotate(map[string]string{internal.PodEipCountAnnotation: "3"})
+		env.reconcilePod("ns", "pod-0")
+
+		var eipAssociation ekspodeipv1.EksPodEipAssociation
+		Expect(env.Client.Get(ctx, associationKey, &eipAssociation)).To(Succeed())
+		Expect(eipAssociation.Spec.SecondaryBindings).To(HaveLen(2))
+		Expect(eipAssociation.Spec.SecondaryBindings[0].PrivateIP).To(Equal("10.0.1.1"))
+		Expect(eipAssociation.Spec.SecondaryBindings[1].PrivateIP).To(Equal("10.0.1.2"))
+	})
+})
+
+var _ = Describe("EipPolicy event handler", func() {
+	var env *fakeEnvironment
+	var queue workqueue.RateLimitingInterface
+
+	newPolicy := func(app string) *ekspodeipv1.EipPolicy {
+		return &ekspodeipv1.EipPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+			Spec: ekspodeipv1.EipPolicySpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			},
+		}
+	}
+
+	queued := func() []ctrl.Request {
+		var requests []ctrl.Request
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			requests = append(requests, item.(ctrl.Request))
+			queue.Done(item)
+		}
+		return requests
+	}
+
+	BeforeEach(func() {
+		var pods []client.Object
+		for name, app := range map[string]string{"pod-a": "a", "pod-b": "b", "pod-c": "c"} {
+			pod := newTestPod("ns", name, "10.0.0.1")
+			pod.Labels = map[string]string{"app": app}
+			pods = append(pods, pod)
+		}
+
+		env = newFakeEnvironment(append(pods, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}})...)
+		queue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	})
+
+	AfterEach(func() {
+		queue.ShutDown()
+	})
+
+	It("enqueues the pods selected by the policy created", func() {
+		env.Assign.eipPolicyEventHandler().Create(event.CreateEvent{Object: newPolicy("a")}, queue)
+
+		Expect(queued()).To(ConsistOf(
+			ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "pod-a"}}))
+	})
+
+	It("enqueues the pods selected by either the old or the new policy updated", func() {
+		env.Assign.eipPolicyEventHandler().Update(event.UpdateEvent{
+			ObjectOld: newPolicy("a"),
+			ObjectNew: newPolicy("b"),
+		}, queue)
+
+		Expect(queued()).To(ConsistOf(
+			ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "pod-a"}},
+			ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "pod-b"}}))
+	})
+})
+
+var _ = Describe("Namespace map function", func() {
+	var env *fakeEnvironment
+
+	BeforeEach(func() {
+		hostNetwork := newTestPod("ns", "pod-host-network", "10.0.0.2")
+		hostNetwork.Spec.HostNetwork = true
+		releasing := newTestPod("ns", "pod-releasing", "")
+		releasing.Finalizers = []string{finalizerName}
+
+		env = newFakeEnvironment(
+			newTestNamespace("ns"),
+			newTestPod("ns", "pod-running", "10.0.0.1"),
+			hostNetwork,
+			newTestPod("ns", "pod-pending", ""),
+			releasing,
+			newTestPod("other", "pod-other", "10.0.0.3"),
+		)
+	})
+
+	It("enqueues only the candidate pods in the namespace changed", func() {
+		ns := newTestNamespace("ns")
+		ns.Annotations = map[string]string{internal.NamespacePodEipPodSelectorAnnotation: "app=edge"}
+
+		Expect(env.Assign.EipAssignNamespaceMapFunc(ns)).To(ConsistOf(
+			ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "pod-running"}},
+			ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "pod-releasing"}}))
+	})
+
+	It("enqueues nothing for the namespace excluded", func() {
+		env.Assign.ExcludedNamespaces = []string{"n?"}
+
+		Expect(env.Assign.EipAssignNamespaceMapFunc(newTestNamespace("ns"))).To(BeEmpty())
+	})
+})
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+const (
+	reasonEipAllocated      = "EipAllocated"
+	reasonEipNotFound       = "EipNotFound"
+	reasonEipAssociated     = "EipAssociated"
+	reasonEipAssociateError = "EipAssociateFailed"
+	reasonEniNotFound       = "EniNotFound"
+	reasonEniLookupError    = "EniLookupFailed"
+	reasonEipConflicted     = "EipConflicted"
+	reasonNoConflict        = "NoConflict"
+	reasonApplied           = "Applied"
+
+	// event only reasons
+	reasonEipReleased         = "EipReleased"
+	reasonEipAllocationFailed = "EipAllocationFailed"
+	reasonIPv4NotFound        = "IPv4NotFound"
+	reasonHostNetworkPod      = "HostNetworkPod"
+)
+
+func setAssociationCondition(eipAssociation *ekspodeipv1.EksPodEipAssociation,
+	conditionType string, status metav1.ConditionStatus, reason, message string) {
+
+	meta.SetStatusCondition(&eipAssociation.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: eipAssociation.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setAssociationApplied marks the association is ready.
+func setAssociationApplied(eipAssociation *ekspodeipv1.EksPodEipAssociation, message string) {
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+		metav1.ConditionTrue, reasonEipAssociated, message)
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationReady,
+		metav1.ConditionTrue, reasonApplied, message)
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationDegraded,
+		metav1.ConditionFalse, reasonApplied, message)
+}
+
+// setAssociationFailed marks the condition is false by the failure, and the association is not ready.
+func setAssociationFailed(eipAssociation *ekspodeipv1.EksPodEipAssociation,
+	conditionType, reason string, err error) {
+
+	message := err.Error()
+
+	setAssociationCondition(eipAssociation, conditionType, metav1.ConditionFalse, reason, message)
+	if conditionType != ekspodeipv1.EipAssociationAssociated {
+		setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+			metav1.ConditionFalse, reason, message)
+	}
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationReady, metav1.ConditionFalse, reason, message)
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationDegraded, metav1.ConditionTrue, reason, message)
+
+	eipAssociation.Status.Associated = false
+}
+
+// setAssociationConflicted marks the association as losing its EIP to another association.
+func setAssociationConflicted(eipAssociation *ekspodeipv1.EksPodEipAssociation, message string) {
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationConflicted,
+		metav1.ConditionTrue, reasonEipConflicted, message)
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationAssociated,
+		metav1.ConditionFalse, reasonEipConflicted, message)
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationReady,
+		metav1.ConditionFalse, reasonEipConflicted, message)
+	setAssociationCondition(eipAssociation, ekspodeipv1.EipAssociationDegraded,
+		metav1.ConditionTrue, reasonEipConflicted, message)
+
+	eipAssociation.Status.Associated = false
+}
+
+// awsConditionReason returns the aws error code, or the fallback for other errors.
+func awsConditionReason(err error, fallback string) string {
+	code := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, awsErrorCode(err))
+
+	if code == "" || !unicode.IsLetter(rune(code[0])) {
+		return fallback
+	}
+
+	return code
+}
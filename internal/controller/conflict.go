@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal/index"
+)
+
+// eipConflictingAssociation returns the older association claiming any EIP of the given one.
+func eipConflictingAssociation(ctx *context.Context, c client.Reader,
+	eipAssociation *ekspodeipv1.EksPodEipAssociation) (*ekspodeipv1.EksPodEipAssociation, error) {
+
+	var eipAssociations []ekspodeipv1.EksPodEipAssociation
+
+	for _, binding := range eipAssociation.Spec.Bindings() {
+		var claims ekspodeipv1.EksPodEipAssociationList
+		if err := c.List(*ctx, &claims,
+			client.MatchingFields{index.AssociationEipAllocationIdField: binding.EipAllocationId}); err != nil {
+			return nil, fmt.Errorf("unable to list EksPodEipAssociations of EIP %s: %v",
+				binding.EipAllocationId, err)
+		}
+		eipAssociations = append(eipAssociations, claims.Items...)
+	}
+
+	var winner *ekspodeipv1.EksPodEipAssociation
+
+	for idx := range eipAssociations {
+		other := &eipAssociations[idx]
+
+		if other.Namespace == eipAssociation.Namespace && other.Name == eipAssociation.Name {
+			continue
+		}
+		// the association being deleted releases the EIP soon, and the one of the same pod is being replaced
+		if !other.DeletionTimestamp.IsZero() ||
+			other.Spec.PodNamespace == eipAssociation.Spec.PodNamespace &&
+				other.Spec.PodName == eipAssociation.Spec.PodName {
+			continue
+		}
+
+		if !eipAssociation.CreationTimestamp.IsZero() && !olderAssociation(other, eipAssociation) {
+			continue
+		}
+		if winner == nil || olderAssociation(other, winner) {
+			winner = other
+		}
+	}
+
+	return winner, nil
+}
+
+func olderAssociation(a, b *ekspodeipv1.EksPodEipAssociation) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	// the timestamp is in seconds, break the tie by the name
+	return fmt.Sprintf("%s/%s", a.Namespace, a.Name) < fmt.Sprintf("%s/%s", b.Namespace, b.Name)
+}
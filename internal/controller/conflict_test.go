@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
+
+func countEvents(events []string, reason string) int {
+	count := 0
+	for _, event := range events {
+		if strings.Contains(event, " "+reason+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+var _ = Describe("EIP claimed by two pods", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+	var eipAllocationId string
+
+	getAssociation := func(name string) *ekspodeipv1.EksPodEipAssociation {
+		var eipAssociation ekspodeipv1.EksPodEipAssociation
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: name}, &eipAssociation)).To(Succeed())
+		return &eipAssociation
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = newFakeEnvironment(newTestNamespace("ns"))
+		env.EC2.AddNetworkInterface("eni-0", testVpcId, "10.0.0.1")
+		env.EC2.AddNetworkInterface("eni-1", testVpcId, "10.0.0.2")
+
+		output, err := env.EC2.AllocateAddress(&ec2.AllocateAddressInput{Domain: aws.String("vpc")})
+		Expect(err).NotTo(HaveOccurred())
+		eipAllocationId = aws.StringValue(output.AllocationId)
+
+		for name, podIP := range map[string]string{"pod-a": "10.0.0.1", "pod-b": "10.0.0.2"} {
+			pod := newTestPod("ns", name, podIP)
+			pod.Annotations = map[string]string{internal.PodEipAllocationIdAnnotation: eipAllocationId}
+			Expect(env.Client.Create(ctx, pod)).To(Succeed())
+		}
+	})
+
+	It("marks the association of the second pod conflicted without reassociating the EIP", func() {
+		env.reconcilePod("ns", "pod-a")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-a")
+
+		address := env.EC2.Addresses()[0]
+		Expect(aws.StringValue(address.PrivateIpAddress)).To(Equal("10.0.0.1"))
+		associationId := aws.StringValue(address.AssociationId)
+
+		env.reconcilePod("ns", "pod-b")
+		Expect(countEvents(env.events(), reasonEipConflicted)).To(Equal(1))
+
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-b")
+
+		eipAssociation := getAssociation("eip-asso-ns-pod-b")
+		Expect(meta.IsStatusConditionTrue(eipAssociation.Status.Conditions,
+			ekspodeipv1.EipAssociationConflicted)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(eipAssociation.Status.Conditions,
+			ekspodeipv1.EipAssociationReady)).To(BeFalse())
+		Expect(eipAssociation.Status.Associated).To(BeFalse())
+		Expect(countEvents(env.events(), reasonEipConflicted)).To(Equal(1))
+
+		By("reconciling both associations again")
+		for i := 0; i < 3; i++ {
+			env.reconcilePod("ns", "pod-a")
+			env.reconcileAssociation("ns", "eip-asso-ns-pod-a")
+			env.reconcilePod("ns", "pod-b")
+			env.reconcileAssociation("ns", "eip-asso-ns-pod-b")
+		}
+
+		// the EIP stays with the first pod, and the conflict is reported once
+		address = env.EC2.Addresses()[0]
+		Expect(aws.StringValue(address.PrivateIpAddress)).To(Equal("10.0.0.1"))
+		Expect(aws.StringValue(address.AssociationId)).To(Equal(associationId))
+		Expect(countEvents(env.events(), reasonEipConflicted)).To(BeZero())
+		Expect(getAssociation("eip-asso-ns-pod-a").Status.Associated).To(BeTrue())
+
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-b"}, &pod)).To(Succeed())
+		Expect(pod.Annotations).NotTo(HaveKey(internal.PodEipAddressAnnotation))
+	})
+
+	It("applies the conflicted association after the first pod has gone", func() {
+		env.reconcilePod("ns", "pod-a")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-a")
+		env.reconcilePod("ns", "pod-b")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-b")
+
+		var pod corev1.Pod
+		Expect(env.Client.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "pod-a"}, &pod)).To(Succeed())
+		Expect(env.Client.Delete(ctx, &pod)).To(Succeed())
+		env.reconcilePod("ns", "pod-a")
+
+		// the conflicted association is enqueued once the association winning the EIP is released
+		Expect(env.Apply.EipConflictingAssociationMapFunc(getAssociation("eip-asso-ns-pod-a"))).To(ConsistOf(
+			ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "eip-asso-ns-pod-b"}}))
+
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-a")
+		env.reconcileAssociation("ns", "eip-asso-ns-pod-b")
+
+		addresses := env.EC2.Addresses()
+		Expect(addresses).To(HaveLen(1))
+		Expect(aws.StringValue(addresses[0].AllocationId)).To(Equal(eipAllocationId))
+		Expect(aws.StringValue(addresses[0].PrivateIpAddress)).To(Equal("10.0.0.2"))
+
+		eipAssociation := getAssociation("eip-asso-ns-pod-b")
+		Expect(meta.IsStatusConditionFalse(eipAssociation.Status.Conditions,
+			ekspodeipv1.EipAssociationConflicted)).To(BeTrue())
+		Expect(eipAssociation.Status.Associated).To(BeTrue())
+	})
+})
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+// recordAssociationEvent records the event on both the association and its pod.
+func recordAssociationEvent(recorder record.EventRecorder, eipAssociation *ekspodeipv1.EksPodEipAssociation,
+	eventType, reason, messageFmt string, args ...interface{}) {
+
+	message := fmt.Sprintf(messageFmt, args...)
+
+	recorder.Event(eipAssociation, eventType, reason, message)
+	if pod := associationPod(eipAssociation); pod != nil {
+		recorder.Event(pod, eventType, reason, message)
+	}
+}
+
+// associationPod returns a reference to the pod owning the association.
+func associationPod(eipAssociation *ekspodeipv1.EksPodEipAssociation) *corev1.Pod {
+	var uid types.UID
+	for _, ownerRef := range eipAssociation.OwnerReferences {
+		if ownerRef.Kind == "Pod" && ownerRef.Name == eipAssociation.Spec.PodName {
+			uid = ownerRef.UID
+			break
+		}
+	}
+	if uid == "" {
+		return nil
+	}
+
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: eipAssociation.Spec.PodNamespace,
+		Name:      eipAssociation.Spec.PodName,
+		UID:       uid,
+	}}
+}
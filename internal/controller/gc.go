@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+	"github.com/zhiyanliu/eks-pod-eip/internal/metrics"
+)
+
+const (
+	podListPageSize = 500
+)
+
+var _ manager.Runnable = &EipGarbageCollector{}
+var _ manager.LeaderElectionRunnable = &EipGarbageCollector{}
+
+// EipGarbageCollector releases the orphaned EIPs and the EIPs no longer retained for any pod.
+type EipGarbageCollector struct {
+	client.Client
+	// APIReader reads the pods not cached, the reader of the Manager by default.
+	APIReader   client.Reader
+	EC2         ec2api.EC2API
+	IPAM        *ipam.IPAddressManager
+	Interval    time.Duration
+	GracePeriod time.Duration
+	DryRun      bool
+	// RetentionPeriod is how long the EIP of a pod owned by no StatefulSet is retained.
+	RetentionPeriod time.Duration
+
+	orphanSince map[string]time.Time
+}
+
+//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations,verbs=list
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get
+
+// SetupWithManager adds the collector, it is disabled if the interval is not positive.
+func (c *EipGarbageCollector) SetupWithManager(mgr manager.Manager) error {
+	if c.Interval <= 0 {
+		return nil
+	}
+	if c.EC2 == nil {
+		return fmt.Errorf("ec2 client is not set")
+	}
+	if c.IPAM == nil {
+		return fmt.Errorf("ipam is not set")
+	}
+	if c.IPAM.ClusterName() == "" {
+		// the EIPs allocated by the controllers of other clusters in the vpc would be released
+		return fmt.Errorf("cluster name is not set")
+	}
+	if c.APIReader == nil {
+		c.APIReader = mgr.GetAPIReader()
+	}
+
+	return mgr.Add(c)
+}
+
+// Start runs the collection periodically until the context is done.
+func (c *EipGarbageCollector) Start(ctx context.Context) error {
+	c.orphanSince = make(map[string]time.Time)
+
+	wait.UntilWithContext(ctx, c.collect, c.Interval)
+
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader releases the EIPs.
+func (c *EipGarbageCollector) NeedLeaderElection() bool {
+	return true
+}
+
+func (c *EipGarbageCollector) collect(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("eip-garbage-collector")
+
+	logger.V(1).Info("----------- collecting orphaned aws EIPs")
+
+	// the EIPs retained are tracked by the store, release the ones no pod comes back for first
+	c.releaseRetainedEips(&ctx, &logger)
+
+	eips, err := c.IPAM.ListManagedEips()
+	if err != nil {
+		logger.Error(err, "unable to list the aws EIPs allocated by the controller")
+		return
+	}
+
+	referenced, err := c.referencedEipAllocationIds(&ctx)
+	if err != nil {
+		logger.Error(err, "unable to list the aws EIPs referenced by EksPodEipAssociations and pods")
+		return
+	}
+
+	tracked, err := c.IPAM.TrackedEipAllocationIds()
+	if err != nil {
+		logger.Error(err, "unable to list the aws EIPs recorded in the store")
+		return
+	}
+
+	now := time.Now()
+	orphanSince := make(map[string]time.Time)
+
+	for _, eip := range eips {
+		eipAllocationId := aws.StringValue(eip.AllocationId)
+
+		if !c.ownedByCluster(eip) {
+			// never touch the EIP of other clusters even if the aws filter is not honored
+			continue
+		}
+
+		if referenced[eipAllocationId] || tracked[eipAllocationId] {
+			continue
+		}
+
+		if podExists, err := c.taggedPodExists(&ctx, eip); err != nil {
+			logger.Error(err, fmt.Sprintf("unable to check the pod of aws EIP %s", eipAllocationId))
+			continue
+		} else if podExists {
+			// the EIP is adopted when the association of the pod is ensured
+			continue
+		}
+
+		since, seen := c.orphanSince[eipAllocationId]
+		if !seen {
+			since = now
+		}
+		orphanSince[eipAllocationId] = since
+
+		if now.Sub(since) < c.GracePeriod {
+			continue
+		}
+
+		if c.DryRun {
+			logger.Info(fmt.Sprintf("aws EIP %s (%s) is orphaned since %s, skip releasing in dry-run mode",
+				eipAllocationId, aws.StringValue(eip.PublicIp), since.Format(time.RFC3339)))
+			continue
+		}
+
+		if err = c.release(&logger, eip); err != nil {
+			logger.Error(err, fmt.Sprintf("unable to release orphaned aws EIP %s", eipAllocationId))
+			continue
+		}
+
+		delete(orphanSince, eipAllocationId)
+	}
+
+	c.orphanSince = orphanSince
+}
+
+func (c *EipGarbageCollector) releaseRetainedEips(ctx *context.Context, logger *logr.Logger) {
+	retainedEips, err := c.IPAM.RetainedEips()
+	if err != nil {
+		logger.Error(err, "unable to list the aws EIPs retained for the pods")
+		return
+	}
+
+	for _, retainedEip := range retainedEips {
+		ended, err := c.retentionEnded(ctx, &retainedEip)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("unable to check the retention of aws EIP %s", retainedEip.EipAllocationId))
+			continue
+		}
+		if !ended {
+			continue
+		}
+
+		if c.DryRun {
+			logger.Info(fmt.Sprintf("aws EIP %s is not needed by pod %s/%s any more, skip releasing in dry-run mode",
+				retainedEip.EipAllocationId, retainedEip.PodNamespace, retainedEip.PodName))
+			continue
+		}
+
+		released, err := c.IPAM.ReleaseRetainedEip(retainedEip)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("unable to release retained aws EIP %s", retainedEip.EipAllocationId))
+			continue
+		}
+		if released {
+			metrics.RecordEipRelease(string(retainedEip.ReleasePolicy))
+			logger.Info(fmt.Sprintf("aws EIP %s retained for pod %s/%s is released",
+				retainedEip.EipAllocationId, retainedEip.PodNamespace, retainedEip.PodName))
+		}
+	}
+}
+
+// retentionEnded checks if the pod the EIP is retained for will never come back.
+func (c *EipGarbageCollector) retentionEnded(ctx *context.Context, retainedEip *ipam.RetainedEip) (bool, error) {
+	var pod corev1.Pod
+	err := c.APIReader.Get(*ctx,
+		types.NamespacedName{Namespace: retainedEip.PodNamespace, Name: retainedEip.PodName}, &pod)
+	if err == nil {
+		// the replacement pod is back, the EIP is reused by it
+		return false, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	if retainedEip.StatefulSet == "" {
+		// the name of the pod owned by no StatefulSet is unlikely to come back
+		return time.Since(retainedEip.Since) >= c.RetentionPeriod, nil
+	}
+
+	retained, err := stickyEipRetained(ctx, c.APIReader, retainedEip.PodNamespace, retainedEip.StatefulSet,
+		retainedEip.PodName)
+	if err != nil {
+		return false, err
+	}
+
+	return !retained, nil
+}
+
+func (c *EipGarbageCollector) referencedEipAllocationIds(ctx *context.Context) (map[string]bool, error) {
+	var eipAssociations ekspodeipv1.EksPodEipAssociationList
+	if err := c.List(*ctx, &eipAssociations); err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool, len(eipAssociations.Items))
+	for _, eipAssociation := range eipAssociations.Items {
+		for _, binding := range eipAssociation.Spec.Bindings() {
+			referenced[binding.EipAllocationId] = true
+		}
+	}
+
+	// the reserved EIPs are referenced by the pods only, listed in pages from the API server
+	continueToken := ""
+	for {
+		var pods corev1.PodList
+		if err := c.APIReader.List(*ctx, &pods, client.Limit(podListPageSize), client.Continue(continueToken)); err != nil {
+			return nil, err
+		}
+
+		for _, pod := range pods.Items {
+			for _, eipAllocationId := range ipam.PodEipAllocationIds(&pod) {
+				referenced[eipAllocationId] = true
+			}
+		}
+
+		if continueToken = pods.Continue; continueToken == "" {
+			break
+		}
+	}
+
+	return referenced, nil
+}
+
+func (c *EipGarbageCollector) ownedByCluster(eip *ec2.Address) bool {
+	for _, tag := range eip.Tags {
+		if aws.StringValue(tag.Key) == internal.EipClusterNameTag {
+			return aws.StringValue(tag.Value) == c.IPAM.ClusterName()
+		}
+	}
+
+	return false
+}
+
+func (c *EipGarbageCollector) taggedPodExists(ctx *context.Context, eip *ec2.Address) (bool, error) {
+	var podNamespace, podName string
+	for _, tag := range eip.Tags {
+		switch aws.StringValue(tag.Key) {
+		case internal.EipPodNamespaceTag:
+			podNamespace = aws.StringValue(tag.Value)
+		case internal.EipPodNameTag:
+			podName = aws.StringValue(tag.Value)
+		}
+	}
+	if podNamespace == "" || podName == "" {
+		return false, nil
+	}
+
+	var pod corev1.Pod
+	if err := c.APIReader.Get(*ctx, types.NamespacedName{Namespace: podNamespace, Name: podName}, &pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return pod.DeletionTimestamp.IsZero(), nil
+}
+
+func (c *EipGarbageCollector) release(logger *logr.Logger, eip *ec2.Address) error {
+	eipAllocationId := aws.StringValue(eip.AllocationId)
+
+	if eip.AssociationId != nil {
+		if err := disassociateAwsEip(c.EC2, aws.StringValue(eip.AssociationId)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.IPAM.ReleaseOrphanEip(eipAllocationId); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("orphaned aws EIP %s (%s) is released", eipAllocationId, aws.StringValue(eip.PublicIp)))
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
+
+var _ = Describe("EipGarbageCollector", func() {
+	var env *fakeEnvironment
+	var ctx context.Context
+	var collector *EipGarbageCollector
+
+	allocateEip := func(clusterName string) string {
+		output, err := env.EC2.AllocateAddress(&ec2.AllocateAddressInput{
+			Domain: aws.String("vpc"),
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String(ec2.ResourceTypeElasticIp),
+				Tags: []*ec2.Tag{
+					{Key: aws.String(internal.EipManagedByTag), Value: aws.String(internal.EipManagedByTagValue)},
+					{Key: aws.String(internal.EipClusterNameTag), Value: aws.String(clusterName)},
+					{Key: aws.String(internal.EipVpcIdTag), Value: aws.String(testVpcId)},
+					{Key: aws.String(internal.EipPodNamespaceTag), Value: aws.String("ns")},
+					{Key: aws.String(internal.EipPodNameTag), Value: aws.String("pod-gone")},
+				},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return aws.StringValue(output.AllocationId)
+	}
+
+	allocationIds := func() []string {
+		var eipAllocationIds []string
+		for _, address := range env.EC2.Addresses() {
+			eipAllocationIds = append(eipAllocationIds, aws.StringValue(address.AllocationId))
+		}
+		return eipAllocationIds
+	}
+
+	retainEip := func(podName, statefulSet string) string {
+		pod := newTestPod("ns", podName, "10.0.0.1")
+		eipAllocationId, _, err := env.IPAM.AllocateEip(pod, "", "eip-asso-ns-"+podName)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(env.IPAM.ReleaseEip(&ekspodeipv1.EksPodEipAssociation{
+			Spec: ekspodeipv1.EksPodEipAssociationSpec{
+				PodNamespace:      "ns",
+				PodName:           podName,
+				PrivateIP:         "10.0.0.1",
+				EipAllocationId:   eipAllocationId,
+				ManagedEip:        true,
+				StickyStatefulSet: statefulSet,
+				ReleasePolicy:     ekspodeipv1.EipReleasePolicyRetain,
+			},
+		})).To(BeEmpty())
+		return eipAllocationId
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		env = newFakeEnvironment(newTestNamespace("ns"))
+		collector = &EipGarbageCollector{
+			Client:          env.Client,
+			APIReader:       env.Client,
+			EC2:             env.EC2,
+			IPAM:            env.IPAM,
+			GracePeriod:     time.Hour,
+			RetentionPeriod: time.Hour,
+			orphanSince:     map[string]time.Time{},
+		}
+	})
+
+	Context("collecting the orphaned EIPs", func() {
+		var orphan string
+
+		BeforeEach(func() {
+			orphan = allocateEip(testClusterName)
+		})
+
+		It("keeps the orphan within the grace period", func() {
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(orphan))
+			Expect(collector.orphanSince).To(HaveKey(orphan))
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(orphan))
+		})
+
+		It("releases the orphan seen for the grace period", func() {
+			collector.orphanSince[orphan] = time.Now().Add(-2 * time.Hour)
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(BeEmpty())
+			Expect(collector.orphanSince).NotTo(HaveKey(orphan))
+		})
+
+		It("reports the orphan in the dry-run mode without releasing it", func() {
+			collector.DryRun = true
+			collector.orphanSince[orphan] = time.Now().Add(-2 * time.Hour)
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(orphan))
+		})
+
+		It("never releases the EIPs of other clusters", func() {
+			other := allocateEip("other-cluster")
+			collector.GracePeriod = 0
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(other))
+		})
+
+		It("keeps the EIP referenced by an association", func() {
+			collector.GracePeriod = 0
+			Expect(env.Client.Create(ctx, &ekspodeipv1.EksPodEipAssociation{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "eip-asso-ns-pod-gone"},
+				Spec: ekspodeipv1.EksPodEipAssociationSpec{
+					PodNamespace:    "ns",
+					PodName:         "pod-gone",
+					EipAllocationId: orphan,
+				},
+			})).To(Succeed())
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(orphan))
+		})
+	})
+
+	Context("ending the retention", func() {
+		It("keeps the EIP retained for the pod until the retention period expires", func() {
+			eipAllocationId := retainEip("pod-0", "")
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(eipAllocationId))
+
+			collector.RetentionPeriod = 0
+			collector.collect(ctx)
+			Expect(allocationIds()).To(BeEmpty())
+			Expect(env.IPAM.RetainedEips()).To(BeEmpty())
+		})
+
+		It("keeps the EIP retained in the dry-run mode", func() {
+			eipAllocationId := retainEip("pod-0", "")
+			collector.RetentionPeriod = 0
+			collector.DryRun = true
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(eipAllocationId))
+		})
+
+		It("reads the StatefulSet the EIP is sticky to through the API server", func() {
+			eipAllocationId := retainEip("web-0", "web")
+			collector.RetentionPeriod = 0
+
+			// the StatefulSet is not cached, e.g. in a namespace not watched
+			collector.APIReader = fake.NewClientBuilder().WithObjects(&appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+				Spec:       appsv1.StatefulSetSpec{Replicas: aws.Int32(1)},
+			}).Build()
+
+			collector.collect(ctx)
+			Expect(allocationIds()).To(ConsistOf(eipAllocationId))
+
+			collector.APIReader = env.Client
+			collector.collect(ctx)
+			Expect(allocationIds()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+)
+
+const (
+	// the EIPs selected by tags are refreshed periodically
+	poolResyncPeriod = time.Minute * 5
+)
+
+// EipPoolReconciler reconciles a EipPool object
+type EipPoolReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	EC2    ec2api.EC2API
+	IPAM   *ipam.IPAddressManager
+}
+
+//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=eippools,verbs=get;list;watch
+//+kubebuilder:rbac:groups=ekspodeip.rp.amazonaws.com,resources=eippools/status,verbs=get;update;patch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.4/pkg/reconcile
+func (r *EipPoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	logger.V(1).Info(fmt.Sprintf("----------- pool event received: %v\n", req))
+
+	var pool ekspodeipv1.EipPool
+	if err := r.Get(ctx, req.NamespacedName, &pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			// ignore not-found error, the pool has been deleted
+			return ctrl.Result{}, nil
+		}
+		logger.V(1).Error(err, fmt.Sprintf("unable to fetch EipPool %s: %v", req.NamespacedName, err))
+		return ctrl.Result{}, err
+	}
+
+	eipAllocationIds, err := r.poolEipAllocationIds(&pool)
+	if err != nil {
+		logger.V(1).Error(err, fmt.Sprintf("unable to resolve the aws EIPs of EipPool %s", pool.Name))
+		return ctrl.Result{}, err
+	}
+
+	free, used, err := r.IPAM.SyncPool(pool.Name, eipAllocationIds)
+	if err != nil {
+		logger.V(1).Error(err, fmt.Sprintf("unable to sync the aws EIPs of EipPool %s", pool.Name))
+		return ctrl.Result{}, err
+	}
+
+	status := ekspodeipv1.EipPoolStatus{
+		Total: free + used,
+		Free:  free,
+		Used:  used,
+	}
+	if pool.Status != status {
+		pool.Status = status
+		if err = r.Status().Update(ctx, &pool); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: poolResyncPeriod}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EipPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.EC2 == nil {
+		return fmt.Errorf("ec2 client is not set")
+	}
+	if r.IPAM == nil {
+		return fmt.Errorf("ipam is not set")
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("eks-pod-eip-pool-controller").
+		For(&ekspodeipv1.EipPool{}).
+		Watches(&source.Channel{Source: r.IPAM.PoolEvents()}, &handler.EnqueueRequestForObject{}).
+		Complete(r)
+}
+
+func (r *EipPoolReconciler) poolEipAllocationIds(pool *ekspodeipv1.EipPool) ([]string, error) {
+	selected := make(map[string]bool)
+
+	for _, eipAllocationId := range pool.Spec.EipAllocationIds {
+		selected[eipAllocationId] = true
+	}
+
+	if len(pool.Spec.TagSelector) > 0 {
+		eipAllocationIds, err := listAwsEipAllocationIds(r.EC2, pool.Spec.TagSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, eipAllocationId := range eipAllocationIds {
+			selected[eipAllocationId] = true
+		}
+	}
+
+	eipAllocationIds := make([]string, 0, len(selected))
+	for eipAllocationId := range selected {
+		eipAllocationIds = append(eipAllocationIds, eipAllocationId)
+	}
+	sort.Strings(eipAllocationIds)
+
+	return eipAllocationIds, nil
+}
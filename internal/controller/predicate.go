@@ -2,28 +2,39 @@ package controller
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
 )
 
 var _ predicate.Predicate = &EipAssignPodPredicate{}
 
 type EipAssignPodPredicate struct {
 	predicate.Funcs
+
+	// ExcludedNamespaces are the glob patterns of the namespaces the pods are ignored in.
+	ExcludedNamespaces []string
 }
 
 func (p EipAssignPodPredicate) Create(e event.CreateEvent) bool {
-	if e.Object.GetNamespace() == "kube-system" {
+	if internal.NamespaceExcluded(p.ExcludedNamespaces, e.Object.GetNamespace()) {
 		return false
 	}
 
-	_, ok := e.Object.(*corev1.Pod)
+	pod, ok := e.Object.(*corev1.Pod)
 	if !ok {
 		return false
 	}
 
+	// the pod opted out is skipped unless the EIP was allocated to it before, it needs to be released then
+	if pod.GetLabels()[internal.PodEipAllocationEnabledLabel] == "false" &&
+		!containsString(pod.Finalizers, internal.PodEipFinalizer) {
+		return false
+	}
+
 	return true
 }
 
@@ -37,11 +48,11 @@ func (p EipAssignPodPredicate) Update(e event.UpdateEvent) bool {
 		return false
 	}
 
-	if newPod.Namespace == "kube-system" {
+	if internal.NamespaceExcluded(p.ExcludedNamespaces, newPod.Namespace) {
 		return false
 	}
 
-	if oldPod.Status.PodIP != newPod.Status.PodIP {
+	if ipam.PodIPv4(oldPod) != ipam.PodIPv4(newPod) || len(oldPod.Status.PodIPs) != len(newPod.Status.PodIPs) {
 		return true
 	}
 
@@ -49,16 +60,34 @@ func (p EipAssignPodPredicate) Update(e event.UpdateEvent) bool {
 		return true
 	}
 
-	oldEipAllocationIdValue, _ := e.ObjectOld.GetAnnotations()[internal.PodEipAllocationIdAnnotation]
-	newEipAllocationIdValue, _ := e.ObjectNew.GetAnnotations()[internal.PodEipAllocationIdAnnotation]
-
-	if oldEipAllocationIdValue != newEipAllocationIdValue {
+	// the pod opts in or out, or its selection changes
+	if !equality.Semantic.DeepEqual(userLabels(oldPod), userLabels(newPod)) {
 		return true
 	}
 
+	// the EIPs of the pod, or the secondary private IPs they are bound with, are changed
+	for _, annotation := range []string{internal.PodEipAllocationIdAnnotation, internal.PodEipCountAnnotation,
+		internal.PodNetworkStatusAnnotation} {
+
+		if e.ObjectOld.GetAnnotations()[annotation] != e.ObjectNew.GetAnnotations()[annotation] {
+			return true
+		}
+	}
+
 	return false
 }
 
+// userLabels returns the labels of the pod without the ones written by the controller.
+func userLabels(pod *corev1.Pod) map[string]string {
+	labels := make(map[string]string, len(pod.GetLabels()))
+	for key, value := range pod.GetLabels() {
+		if key != internal.PodEipAddressLabel {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
 //func (p EipAssignPodPredicate) Delete(e event.DeleteEvent) bool {
 //	if e.Object.GetNamespace() == "kube-system" {
 //		return false
@@ -73,7 +102,7 @@ func (p EipAssignPodPredicate) Update(e event.UpdateEvent) bool {
 //}
 
 func (p EipAssignPodPredicate) Generic(e event.GenericEvent) bool {
-	if e.Object.GetNamespace() == "kube-system" {
+	if internal.NamespaceExcluded(p.ExcludedNamespaces, e.Object.GetNamespace()) {
 		return false
 	}
 
@@ -89,6 +118,9 @@ var _ predicate.Predicate = &EipAssignNamespacePredicate{}
 
 type EipAssignNamespacePredicate struct {
 	predicate.Funcs
+
+	// ExcludedNamespaces are the glob patterns of the namespaces ignored.
+	ExcludedNamespaces []string
 }
 
 func (p EipAssignNamespacePredicate) Create(e event.CreateEvent) bool {
@@ -105,14 +137,20 @@ func (p EipAssignNamespacePredicate) Update(e event.UpdateEvent) bool {
 		return false
 	}
 
-	if newNs.GetNamespace() == "kube-system" {
+	// the namespace is cluster scoped, its name is the namespace the pods are in
+	if internal.NamespaceExcluded(p.ExcludedNamespaces, newNs.GetName()) {
 		return false
 	}
 
-	oldValue, _ := e.ObjectOld.GetLabels()[internal.NamespacePodEipAllocationEnabledLabel]
-	newValue, _ := e.ObjectNew.GetLabels()[internal.NamespacePodEipAllocationEnabledLabel]
+	// the namespace is enabled or disabled, or its selection changes
+	if !equality.Semantic.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+		return true
+	}
+
+	oldSelector, _ := e.ObjectOld.GetAnnotations()[internal.NamespacePodEipPodSelectorAnnotation]
+	newSelector, _ := e.ObjectNew.GetAnnotations()[internal.NamespacePodEipPodSelectorAnnotation]
 
-	return oldValue != newValue
+	return oldSelector != newSelector
 }
 
 func (p EipAssignNamespacePredicate) Delete(e event.DeleteEvent) bool {
@@ -120,14 +158,10 @@ func (p EipAssignNamespacePredicate) Delete(e event.DeleteEvent) bool {
 }
 
 func (p EipAssignNamespacePredicate) Generic(e event.GenericEvent) bool {
-	if e.Object.GetNamespace() == "kube-system" {
-		return false
-	}
-
-	_, ok := e.Object.(*corev1.Namespace)
+	ns, ok := e.Object.(*corev1.Namespace)
 	if !ok {
 		return false
 	}
 
-	return true
+	return !internal.NamespaceExcluded(p.ExcludedNamespaces, ns.GetName())
 }
@@ -0,0 +1,110 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
+
+var _ = Describe("EipAssignPodPredicate", func() {
+	DescribeTable("updating the annotations of the pod",
+		func(annotation string, expected bool) {
+			oldPod := newTestPod("ns", "pod-0", "10.0.0.1")
+			newPod := oldPod.DeepCopy()
+			newPod.Annotations = map[string]string{annotation: "2"}
+
+			Expect(EipAssignPodPredicate{}.Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})).
+				To(Equal(expected))
+		},
+		Entry("the EIP allocation id", internal.PodEipAllocationIdAnnotation, true),
+		Entry("the EIP count", internal.PodEipCountAnnotation, true),
+		Entry("the network status", internal.PodNetworkStatusAnnotation, true),
+		Entry("an unrelated annotation", "example.com/unrelated", false),
+		Entry("the EIP address written by the controller", internal.PodEipAddressAnnotation, false),
+		Entry("the association id written by the controller", internal.PodEipAssociationIdAnnotation, false),
+	)
+
+	DescribeTable("updating the labels of the pod",
+		func(label string, expected bool) {
+			oldPod := newTestPod("ns", "pod-0", "10.0.0.1")
+			newPod := oldPod.DeepCopy()
+			newPod.Labels = map[string]string{label: "false"}
+
+			Expect(EipAssignPodPredicate{}.Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})).
+				To(Equal(expected))
+		},
+		Entry("the opt-out label", internal.PodEipAllocationEnabledLabel, true),
+		Entry("a label the pod selector might match", "app", true),
+		Entry("the EIP address written by the controller", internal.PodEipAddressLabel, false),
+	)
+})
+
+var _ = Describe("EipAssignNamespacePredicate", func() {
+	newNamespace := func(name string, labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations},
+		}
+	}
+
+	enabled := map[string]string{internal.NamespacePodEipAllocationEnabledLabel: "true"}
+	selector := map[string]string{internal.NamespacePodEipPodSelectorAnnotation: "app=edge"}
+
+	DescribeTable("updating the namespace",
+		func(excluded []string, oldNs, newNs *corev1.Namespace, expected bool) {
+			p := EipAssignNamespacePredicate{ExcludedNamespaces: excluded}
+
+			Expect(p.Update(event.UpdateEvent{ObjectOld: oldNs, ObjectNew: newNs})).To(Equal(expected))
+		},
+		Entry("the namespace enabled", nil,
+			newNamespace("ns", nil, nil), newNamespace("ns", enabled, nil), true),
+		Entry("the pod selector changed", nil,
+			newNamespace("ns", enabled, nil), newNamespace("ns", enabled, selector), true),
+		Entry("an unrelated annotation changed", nil,
+			newNamespace("ns", enabled, nil), newNamespace("ns", enabled, map[string]string{"a": "b"}), false),
+		Entry("the namespace excluded by the name", []string{"ns"},
+			newNamespace("ns", nil, nil), newNamespace("ns", enabled, nil), false),
+		Entry("the namespace excluded by the glob pattern", []string{"kube-*"},
+			newNamespace("kube-public", nil, nil), newNamespace("kube-public", enabled, nil), false),
+		Entry("another namespace excluded", []string{"kube-*"},
+			newNamespace("ns", nil, nil), newNamespace("ns", enabled, nil), true),
+	)
+
+	DescribeTable("the generic event of the namespace",
+		func(excluded []string, name string, expected bool) {
+			p := EipAssignNamespacePredicate{ExcludedNamespaces: excluded}
+
+			Expect(p.Generic(event.GenericEvent{Object: newNamespace(name, enabled, nil)})).To(Equal(expected))
+		},
+		Entry("no namespace excluded", nil, "kube-system", true),
+		Entry("the namespace excluded", []string{"kube-*"}, "kube-system", false),
+		Entry("another namespace excluded", []string{"kube-*"}, "ns", true),
+	)
+
+	It("ignores the creation and the deletion of the namespace", func() {
+		p := EipAssignNamespacePredicate{}
+		ns := newNamespace("ns", enabled, nil)
+
+		Expect(p.Create(event.CreateEvent{Object: ns})).To(BeFalse())
+		Expect(p.Delete(event.DeleteEvent{Object: ns})).To(BeFalse())
+	})
+})
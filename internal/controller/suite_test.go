@@ -17,30 +17,39 @@ limitations under the License.
 package controller
 
 import (
-	"path/filepath"
+	"context"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+	"github.com/zhiyanliu/eks-pod-eip/internal/index"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
 	//+kubebuilder:scaffold:imports
 )
 
+const (
+	testVpcId       = "vpc-0123456789abcdef0"
+	testClusterName = "test-cluster"
+)
+
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
 // http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
 
-var cfg *rest.Config
-var k8sClient client.Client
-var testEnv *envtest.Environment
-
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -49,32 +58,102 @@ func TestAPIs(t *testing.T) {
 
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
+})
 
-	By("bootstrapping test environment")
-	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
-		ErrorIfCRDPathMissing: false,
-	}
+// fakeEnvironment runs the reconcilers against the fake client and the in-memory EC2,
+// the specs drive the reconciliation by calling Reconcile in the order the events would arrive.
+type fakeEnvironment struct {
+	Client   client.Client
+	EC2      *ec2api.FakeEC2
+	Recorder *record.FakeRecorder
+	IPAM     *ipam.IPAddressManager
+	Assign   *EksPodEipAssignReconciler
+	Apply    *EksPodEipApplyReconciler
+}
+
+func newFakeEnvironment(objs ...client.Object) *fakeEnvironment {
+	testScheme := runtime.NewScheme()
+	Expect(scheme.AddToScheme(testScheme)).To(Succeed())
+	Expect(ekspodeipv1.AddToScheme(testScheme)).To(Succeed())
+
+	builder := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objs...)
+	Expect(index.SetupIndexes(context.Background(), fakeIndexer{builder})).To(Succeed())
 
+	env := &fakeEnvironment{
+		Client:   &creationTimestampClient{Client: builder.Build()},
+		EC2:      ec2api.NewFakeEC2(),
+		Recorder: record.NewFakeRecorder(100),
+	}
 	var err error
-	// cfg is defined in this file globally.
-	cfg, err = testEnv.Start()
+	env.IPAM, err = ipam.NewIPAddressManager(env.EC2, testVpcId, testClusterName,
+		func(name string) (ipam.IPAddressStore, error) {
+			return ipam.NewConfigMapIPAddressStore(env.Client, "default", name)
+		})
 	Expect(err).NotTo(HaveOccurred())
-	Expect(cfg).NotTo(BeNil())
+	env.Assign = &EksPodEipAssignReconciler{
+		Client:   env.Client,
+		Scheme:   testScheme,
+		Recorder: env.Recorder,
+		IPAM:     env.IPAM,
+		VpcId:    testVpcId,
+	}
+	env.Apply = &EksPodEipApplyReconciler{
+		Client:   env.Client,
+		Scheme:   testScheme,
+		Recorder: env.Recorder,
+		EC2:      env.EC2,
+		IPAM:     env.IPAM,
+	}
 
-	err = ekspodeipv1.AddToScheme(scheme.Scheme)
-	Expect(err).NotTo(HaveOccurred())
+	return env
+}
 
-	//+kubebuilder:scaffold:scheme
+func (e *fakeEnvironment) reconcilePod(namespace, name string) {
+	_, err := e.Assign.Reconcile(context.Background(),
+		ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}})
+	Expect(err).NotTo(HaveOccurred())
+}
 
-	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+func (e *fakeEnvironment) reconcileAssociation(namespace, name string) {
+	_, err := e.Apply.Reconcile(context.Background(),
+		ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}})
 	Expect(err).NotTo(HaveOccurred())
-	Expect(k8sClient).NotTo(BeNil())
+}
 
-})
+// events drains the events recorded so far.
+func (e *fakeEnvironment) events() []string {
+	var events []string
+	for {
+		select {
+		case event := <-e.Recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
 
-var _ = AfterSuite(func() {
-	By("tearing down the test environment")
-	err := testEnv.Stop()
-	Expect(err).NotTo(HaveOccurred())
-})
+// fakeIndexer registers the field indexes on the fake client builder, the same indexes as the cache of the Manager.
+type fakeIndexer struct {
+	builder *fake.ClientBuilder
+}
+
+func (i fakeIndexer) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	i.builder.WithIndex(obj, field, extractValue)
+	return nil
+}
+
+// creationTimestampClient stamps the objects created in the order of the creation as the API server does,
+// the fake client leaves the creation timestamp empty.
+type creationTimestampClient struct {
+	client.Client
+
+	created int
+}
+
+func (c *creationTimestampClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.created++
+	obj.SetCreationTimestamp(metav1.NewTime(time.Date(2023, 1, 1, 0, 0, c.created, 0, time.UTC)))
+
+	return c.Client.Create(ctx, obj, opts...)
+}
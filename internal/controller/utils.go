@@ -1,9 +1,27 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+	"github.com/zhiyanliu/eks-pod-eip/internal/metrics"
 )
 
 func containsString(slice []string, s string) bool {
@@ -15,6 +33,28 @@ func containsString(slice []string, s string) bool {
 	return false
 }
 
+// setOrRemove sets or removes the key in the map, and returns whether the map changed.
+func setOrRemove(m *map[string]string, key, value string, set bool) bool {
+	current, exists := (*m)[key]
+
+	if !set || value == "" {
+		if exists {
+			delete(*m, key)
+		}
+		return exists
+	}
+
+	if exists && current == value {
+		return false
+	}
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	(*m)[key] = value
+
+	return true
+}
+
 func removeString(slice []string, s string) (result []string) {
 	for _, item := range slice {
 		if item == s {
@@ -25,9 +65,77 @@ func removeString(slice []string, s string) (result []string) {
 	return
 }
 
-func getAwsEniId(awsSession *session.Session, privateIP string) (string, error) {
-	ec2Svc := ec2.New(awsSession)
+// statefulSetOrdinal returns the name of the StatefulSet owning the pod and the ordinal of the pod.
+func statefulSetOrdinal(pod *corev1.Pod) (string, int, bool) {
+	for _, ownerRef := range pod.GetOwnerReferences() {
+		if ownerRef.Kind != "StatefulSet" || ownerRef.Controller == nil || !*ownerRef.Controller {
+			continue
+		}
+
+		prefix := ownerRef.Name + "-"
+		if !strings.HasPrefix(pod.GetName(), prefix) {
+			return "", 0, false
+		}
+
+		ordinal, err := strconv.Atoi(strings.TrimPrefix(pod.GetName(), prefix))
+		if err != nil || ordinal < 0 {
+			return "", 0, false
+		}
+
+		return ownerRef.Name, ordinal, true
+	}
+
+	return "", 0, false
+}
+
+// stickyEipRetained checks if the StatefulSet still needs the EIP of the pod ordinal.
+func stickyEipRetained(ctx *context.Context, c client.Reader, namespace, statefulSetName, podName string) (bool, error) {
+	if statefulSetName == "" {
+		return false, nil
+	}
 
+	var statefulSet appsv1.StatefulSet
+	if err := c.Get(*ctx, types.NamespacedName{Namespace: namespace, Name: statefulSetName}, &statefulSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !statefulSet.DeletionTimestamp.IsZero() {
+		return false, nil
+	}
+
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(podName, statefulSetName+"-"))
+	if err != nil {
+		return false, nil
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	return int32(ordinal) < replicas, nil
+}
+
+func isValidReleasePolicy(value string) bool {
+	switch ekspodeipv1.EipReleasePolicy(value) {
+	case ekspodeipv1.EipReleasePolicyDelete, ekspodeipv1.EipReleasePolicyRetain, ekspodeipv1.EipReleasePolicyReturnToPool:
+		return true
+	}
+	return false
+}
+
+func awsErrorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+// getAwsEniId returns the id of the ENI the private IP belongs to.
+func getAwsEniId(ec2Svc ec2api.EC2API, privateIP string) (string, error) {
 	result, err := ec2Svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
 		Filters: []*ec2.Filter{
 			{
@@ -47,3 +155,190 @@ func getAwsEniId(awsSession *session.Session, privateIP string) (string, error)
 
 	return *result.NetworkInterfaces[0].NetworkInterfaceId, nil
 }
+
+func getAwsEip(ec2Svc ec2api.EC2API, eipAllocationId string) (*ec2.Address, error) {
+	result, err := ec2Svc.DescribeAddresses(&ec2.DescribeAddressesInput{
+		AllocationIds: []*string{aws.String(eipAllocationId)},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Addresses) == 0 {
+		return nil, fmt.Errorf("no EIP found for allocation id %s", eipAllocationId)
+	}
+
+	return result.Addresses[0], nil
+}
+
+func associateAwsEip(ec2Svc ec2api.EC2API, eipAllocationId, eniId, privateIP string) (string, error) {
+	result, err := ec2Svc.AssociateAddress(&ec2.AssociateAddressInput{
+		AllocationId:       aws.String(eipAllocationId),
+		NetworkInterfaceId: aws.String(eniId),
+		PrivateIpAddress:   aws.String(privateIP),
+		AllowReassociation: aws.Bool(true),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(result.AssociationId), nil
+}
+
+func disassociateAwsEip(ec2Svc ec2api.EC2API, associationId string) error {
+	_, err := ec2Svc.DisassociateAddress(&ec2.DisassociateAddressInput{
+		AssociationId: aws.String(associationId),
+	})
+
+	if err != nil && awsErrorCode(err) != "InvalidAssociationID.NotFound" {
+		return err
+	}
+
+	return nil
+}
+
+func listAwsEipAllocationIds(ec2Svc ec2api.EC2API, tags map[string]string) ([]string, error) {
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("domain"),
+			Values: []*string{aws.String("vpc")},
+		},
+	}
+	for key, value := range tags {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", key)),
+			Values: []*string{aws.String(value)},
+		})
+	}
+
+	result, err := ec2Svc.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: filters,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	eipAllocationIds := make([]string, 0, len(result.Addresses))
+	for _, address := range result.Addresses {
+		eipAllocationIds = append(eipAllocationIds, aws.StringValue(address.AllocationId))
+	}
+
+	return eipAllocationIds, nil
+}
+
+// podSecondaryIPs returns the IPv4 addresses of the secondary interfaces of the pod.
+func podSecondaryIPs(pod *corev1.Pod) []string {
+	value, exists := pod.GetAnnotations()[internal.PodNetworkStatusAnnotation]
+	if !exists {
+		return nil
+	}
+
+	var networks []struct {
+		IPs     []string `json:"ips"`
+		Default bool     `json:"default"`
+	}
+	if err := json.Unmarshal([]byte(value), &networks); err != nil {
+		return nil
+	}
+
+	var ips []string
+	for _, network := range networks {
+		if network.Default {
+			continue
+		}
+		for _, ip := range network.IPs {
+			if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil && ip != ipam.PodIPv4(pod) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	return ips
+}
+
+// podOnFargate checks if the pod is scheduled to Fargate by the label set by the Fargate profile.
+func podOnFargate(pod *corev1.Pod) bool {
+	_, exists := pod.GetLabels()[internal.PodFargateProfileLabel]
+	return exists
+}
+
+// podIPs returns the comma-separated IPs of the pod.
+func podIPs(pod *corev1.Pod) string {
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+	if len(ips) == 0 {
+		return pod.Status.PodIP
+	}
+
+	return strings.Join(ips, ",")
+}
+
+// ipFamily returns the family of the IP address, empty if the IP address is invalid.
+func ipFamily(address string) corev1.IPFamily {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return corev1.IPv4Protocol
+	default:
+		return corev1.IPv6Protocol
+	}
+}
+
+// podEipCount returns the number of EIPs the pod requests.
+func podEipCount(pod *corev1.Pod, eipAllocationIds []string) int {
+	count, err := strconv.Atoi(pod.GetAnnotations()[internal.PodEipCountAnnotation])
+	if err != nil || count < len(eipAllocationIds) {
+		count = len(eipAllocationIds)
+	}
+	if count < 1 {
+		return 1
+	}
+
+	return count
+}
+
+// secondaryEipCount returns the number of EIPs bound to the secondary private IPs of the pod.
+func secondaryEipCount(pod *corev1.Pod, spec *ekspodeipv1.EksPodEipAssociationSpec) int {
+	eipAllocationIds := ipam.PodEipAllocationIds(pod)
+
+	count := podEipCount(pod, eipAllocationIds) - 1
+	if !spec.ManagedEip && spec.EipPool == "" && count > len(eipAllocationIds)-1 {
+		count = len(eipAllocationIds) - 1
+	}
+	if secondaryIPs := podSecondaryIPs(pod); count > len(secondaryIPs) {
+		count = len(secondaryIPs)
+	}
+	if count < 0 {
+		return 0
+	}
+
+	return count
+}
+
+// releasePolicy returns the release policy of the association, the EIP is deleted by default.
+func releasePolicy(spec *ekspodeipv1.EksPodEipAssociationSpec) ekspodeipv1.EipReleasePolicy {
+	if spec.ReleasePolicy == "" {
+		return ekspodeipv1.EipReleasePolicyDelete
+	}
+	return spec.ReleasePolicy
+}
+
+// allocationSource returns where the EIP of the association comes from, for the metrics.
+func allocationSource(spec *ekspodeipv1.EksPodEipAssociationSpec) string {
+	switch {
+	case spec.EipPool != "":
+		return metrics.SourcePool
+	case spec.ManagedEip || spec.EipAllocationId == "":
+		// the EIP not allocated yet is allocated by the controller unless it is drawn from the pool
+		return metrics.SourceController
+	default:
+		return metrics.SourceUser
+	}
+}
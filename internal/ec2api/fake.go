@@ -0,0 +1,420 @@
+package ec2api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+var _ EC2API = &FakeEC2{}
+
+// FakeEC2 is an in-memory EC2API supporting only the filters the controller uses.
+type FakeEC2 struct {
+	lock sync.Mutex
+
+	addresses         map[string]*ec2.Address
+	networkInterfaces map[string]*ec2.NetworkInterface
+	instances         map[string]*ec2.Instance
+
+	sequence int
+}
+
+func NewFakeEC2() *FakeEC2 {
+	return &FakeEC2{
+		addresses:         make(map[string]*ec2.Address),
+		networkInterfaces: make(map[string]*ec2.NetworkInterface),
+		instances:         make(map[string]*ec2.Instance),
+	}
+}
+
+// AddNetworkInterface adds an ENI with the private IPs, the first one is the primary.
+func (f *FakeEC2) AddNetworkInterface(eniId, vpcId string, privateIPs ...string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	eni := &ec2.NetworkInterface{
+		NetworkInterfaceId: aws.String(eniId),
+		VpcId:              aws.String(vpcId),
+	}
+	for idx, privateIP := range privateIPs {
+		if idx == 0 {
+			eni.PrivateIpAddress = aws.String(privateIP)
+		}
+		eni.PrivateIpAddresses = append(eni.PrivateIpAddresses, &ec2.NetworkInterfacePrivateIpAddress{
+			Primary:          aws.Bool(idx == 0),
+			PrivateIpAddress: aws.String(privateIP),
+		})
+	}
+
+	f.networkInterfaces[eniId] = eni
+}
+
+// RemoveNetworkInterface removes the ENI, the EIPs associated with it are disassociated.
+func (f *FakeEC2) RemoveNetworkInterface(eniId string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, address := range f.addresses {
+		if aws.StringValue(address.NetworkInterfaceId) == eniId {
+			disassociate(address)
+		}
+	}
+
+	delete(f.networkInterfaces, eniId)
+}
+
+// AddInstance adds an instance in the vpc.
+func (f *FakeEC2) AddInstance(instanceId, vpcId string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.instances[instanceId] = &ec2.Instance{
+		InstanceId: aws.String(instanceId),
+		VpcId:      aws.String(vpcId),
+	}
+}
+
+// Addresses returns a copy of all the EIPs.
+func (f *FakeEC2) Addresses() []*ec2.Address {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	addresses := make([]*ec2.Address, 0, len(f.addresses))
+	for _, address := range f.addresses {
+		addresses = append(addresses, copyAddress(address))
+	}
+
+	return addresses
+}
+
+func (f *FakeEC2) AllocateAddress(input *ec2.AllocateAddressInput) (*ec2.AllocateAddressOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.sequence++
+
+	address := &ec2.Address{
+		AllocationId: aws.String(fmt.Sprintf("eipalloc-%017x", f.sequence)),
+		PublicIp:     aws.String(fmt.Sprintf("198.51.%d.%d", f.sequence/254%256, f.sequence%254+1)),
+		Domain:       aws.String("vpc"),
+	}
+	for _, tagSpecification := range input.TagSpecifications {
+		if aws.StringValue(tagSpecification.ResourceType) == ec2.ResourceTypeElasticIp {
+			address.Tags = mergeTags(address.Tags, tagSpecification.Tags)
+		}
+	}
+
+	f.addresses[aws.StringValue(address.AllocationId)] = address
+
+	return &ec2.AllocateAddressOutput{
+		AllocationId: address.AllocationId,
+		PublicIp:     address.PublicIp,
+		Domain:       address.Domain,
+	}, nil
+}
+
+func (f *FakeEC2) ReleaseAddress(input *ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	address, err := f.address(aws.StringValue(input.AllocationId))
+	if err != nil {
+		return nil, err
+	}
+
+	if address.AssociationId != nil {
+		return nil, awserr.New("InvalidIPAddress.InUse",
+			fmt.Sprintf("address %s is in use", aws.StringValue(address.PublicIp)), nil)
+	}
+
+	delete(f.addresses, aws.StringValue(input.AllocationId))
+
+	return &ec2.ReleaseAddressOutput{}, nil
+}
+
+func (f *FakeEC2) AssociateAddress(input *ec2.AssociateAddressInput) (*ec2.AssociateAddressOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	address, err := f.address(aws.StringValue(input.AllocationId))
+	if err != nil {
+		return nil, err
+	}
+
+	eni, exists := f.networkInterfaces[aws.StringValue(input.NetworkInterfaceId)]
+	if !exists {
+		return nil, awserr.New("InvalidNetworkInterfaceID.NotFound",
+			fmt.Sprintf("the network interface %s does not exist", aws.StringValue(input.NetworkInterfaceId)), nil)
+	}
+
+	privateIP := aws.StringValue(input.PrivateIpAddress)
+	if privateIP == "" {
+		privateIP = aws.StringValue(eni.PrivateIpAddress)
+	}
+	if !hasPrivateIP(eni, privateIP) {
+		return nil, awserr.New("InvalidParameterValue", fmt.Sprintf("private IP %s is not on network interface %s",
+			privateIP, aws.StringValue(eni.NetworkInterfaceId)), nil)
+	}
+
+	if address.AssociationId != nil && !aws.BoolValue(input.AllowReassociation) {
+		return nil, awserr.New("Resource.AlreadyAssociated",
+			fmt.Sprintf("address %s is already associated", aws.StringValue(address.PublicIp)), nil)
+	}
+
+	// a private IP has at most one EIP
+	for _, other := range f.addresses {
+		if aws.StringValue(other.NetworkInterfaceId) == aws.StringValue(eni.NetworkInterfaceId) &&
+			aws.StringValue(other.PrivateIpAddress) == privateIP {
+			disassociate(other)
+		}
+	}
+
+	f.sequence++
+
+	address.AssociationId = aws.String(fmt.Sprintf("eipassoc-%017x", f.sequence))
+	address.NetworkInterfaceId = eni.NetworkInterfaceId
+	address.PrivateIpAddress = aws.String(privateIP)
+
+	return &ec2.AssociateAddressOutput{AssociationId: address.AssociationId}, nil
+}
+
+func (f *FakeEC2) DisassociateAddress(input *ec2.DisassociateAddressInput) (*ec2.DisassociateAddressOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, address := range f.addresses {
+		if aws.StringValue(address.AssociationId) == aws.StringValue(input.AssociationId) {
+			disassociate(address)
+			return &ec2.DisassociateAddressOutput{}, nil
+		}
+	}
+
+	return nil, awserr.New("InvalidAssociationID.NotFound",
+		fmt.Sprintf("the association %s does not exist", aws.StringValue(input.AssociationId)), nil)
+}
+
+func (f *FakeEC2) DescribeAddresses(input *ec2.DescribeAddressesInput) (*ec2.DescribeAddressesOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var candidates []*ec2.Address
+	if len(input.AllocationIds) > 0 {
+		for _, allocationId := range input.AllocationIds {
+			address, err := f.address(aws.StringValue(allocationId))
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, address)
+		}
+	} else {
+		for _, address := range f.addresses {
+			candidates = append(candidates, address)
+		}
+	}
+
+	output := &ec2.DescribeAddressesOutput{}
+	for _, address := range candidates {
+		if matchAddress(address, input.Filters) {
+			output.Addresses = append(output.Addresses, copyAddress(address))
+		}
+	}
+
+	return output, nil
+}
+
+func (f *FakeEC2) DescribeNetworkInterfaces(
+	input *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	output := &ec2.DescribeNetworkInterfacesOutput{}
+	for _, eni := range f.networkInterfaces {
+		if len(input.NetworkInterfaceIds) > 0 && !containsValue(input.NetworkInterfaceIds, eni.NetworkInterfaceId) {
+			continue
+		}
+		if matchNetworkInterface(eni, input.Filters) {
+			output.NetworkInterfaces = append(output.NetworkInterfaces, eni)
+		}
+	}
+
+	return output, nil
+}
+
+func (f *FakeEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	reservation := &ec2.Reservation{}
+	for _, instanceId := range input.InstanceIds {
+		instance, exists := f.instances[aws.StringValue(instanceId)]
+		if !exists {
+			return nil, awserr.New("InvalidInstanceID.NotFound",
+				fmt.Sprintf("the instance %s does not exist", aws.StringValue(instanceId)), nil)
+		}
+		reservation.Instances = append(reservation.Instances, instance)
+	}
+
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{reservation}}, nil
+}
+
+func (f *FakeEC2) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, resource := range input.Resources {
+		address, err := f.address(aws.StringValue(resource))
+		if err != nil {
+			return nil, err
+		}
+		address.Tags = mergeTags(address.Tags, input.Tags)
+	}
+
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (f *FakeEC2) address(allocationId string) (*ec2.Address, error) {
+	address, exists := f.addresses[allocationId]
+	if !exists {
+		return nil, awserr.New("InvalidAllocationID.NotFound",
+			fmt.Sprintf("the allocation ID '%s' does not exist", allocationId), nil)
+	}
+	return address, nil
+}
+
+func disassociate(address *ec2.Address) {
+	address.AssociationId = nil
+	address.NetworkInterfaceId = nil
+	address.PrivateIpAddress = nil
+}
+
+func copyAddress(address *ec2.Address) *ec2.Address {
+	addressCopy := *address
+	addressCopy.Tags = mergeTags(nil, address.Tags)
+	return &addressCopy
+}
+
+func mergeTags(tags, newTags []*ec2.Tag) []*ec2.Tag {
+	merged := make([]*ec2.Tag, 0, len(tags)+len(newTags))
+	for _, tag := range tags {
+		merged = append(merged, &ec2.Tag{Key: tag.Key, Value: tag.Value})
+	}
+
+	for _, newTag := range newTags {
+		replaced := false
+		for _, tag := range merged {
+			if aws.StringValue(tag.Key) == aws.StringValue(newTag.Key) {
+				tag.Value = newTag.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, &ec2.Tag{Key: newTag.Key, Value: newTag.Value})
+		}
+	}
+
+	return merged
+}
+
+func hasPrivateIP(eni *ec2.NetworkInterface, privateIP string) bool {
+	for _, address := range eni.PrivateIpAddresses {
+		if aws.StringValue(address.PrivateIpAddress) == privateIP {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []*string, value *string) bool {
+	for _, v := range values {
+		if aws.StringValue(v) == aws.StringValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func tagValue(tags []*ec2.Tag, key string) *string {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return tag.Value
+		}
+	}
+	return nil
+}
+
+func matchAddress(address *ec2.Address, filters []*ec2.Filter) bool {
+	for _, filter := range filters {
+		name := aws.StringValue(filter.Name)
+
+		var value *string
+		switch {
+		case strings.HasPrefix(name, "tag:"):
+			value = tagValue(address.Tags, strings.TrimPrefix(name, "tag:"))
+		case name == "tag-key":
+			matched := false
+			for _, key := range filter.Values {
+				matched = matched || tagValue(address.Tags, aws.StringValue(key)) != nil
+			}
+			if !matched {
+				return false
+			}
+			continue
+		case name == "domain":
+			value = address.Domain
+		case name == "allocation-id":
+			value = address.AllocationId
+		case name == "association-id":
+			value = address.AssociationId
+		case name == "network-interface-id":
+			value = address.NetworkInterfaceId
+		case name == "private-ip-address":
+			value = address.PrivateIpAddress
+		case name == "public-ip":
+			value = address.PublicIp
+		default:
+			panic(fmt.Sprintf("unsupported address filter %s", name))
+		}
+
+		if value == nil || !containsValue(filter.Values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchNetworkInterface(eni *ec2.NetworkInterface, filters []*ec2.Filter) bool {
+	for _, filter := range filters {
+		switch name := aws.StringValue(filter.Name); name {
+		case "addresses.private-ip-address":
+			matched := false
+			for _, address := range eni.PrivateIpAddresses {
+				matched = matched || containsValue(filter.Values, address.PrivateIpAddress)
+			}
+			if !matched {
+				return false
+			}
+		case "private-ip-address":
+			if !containsValue(filter.Values, eni.PrivateIpAddress) {
+				return false
+			}
+		case "vpc-id":
+			if !containsValue(filter.Values, eni.VpcId) {
+				return false
+			}
+		case "network-interface-id":
+			if !containsValue(filter.Values, eni.NetworkInterfaceId) {
+				return false
+			}
+		default:
+			panic(fmt.Sprintf("unsupported network interface filter %s", name))
+		}
+	}
+
+	return true
+}
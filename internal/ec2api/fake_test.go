@@ -0,0 +1,301 @@
+package ec2api
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testVpcId = "vpc-0123456789abcdef0"
+)
+
+func errorCode(err error) string {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+var _ = Describe("FakeEC2", func() {
+	var fake *FakeEC2
+
+	allocate := func(tags ...*ec2.Tag) string {
+		output, err := fake.AllocateAddress(&ec2.AllocateAddressInput{
+			Domain: aws.String("vpc"),
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String(ec2.ResourceTypeElasticIp),
+				Tags:         tags,
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return aws.StringValue(output.AllocationId)
+	}
+
+	associate := func(eipAllocationId, eniId, privateIP string) (string, error) {
+		output, err := fake.AssociateAddress(&ec2.AssociateAddressInput{
+			AllocationId:       aws.String(eipAllocationId),
+			NetworkInterfaceId: aws.String(eniId),
+			PrivateIpAddress:   aws.String(privateIP),
+			AllowReassociation: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(output.AssociationId), nil
+	}
+
+	describe := func(eipAllocationId string) *ec2.Address {
+		output, err := fake.DescribeAddresses(&ec2.DescribeAddressesInput{
+			AllocationIds: []*string{aws.String(eipAllocationId)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.Addresses).To(HaveLen(1))
+		return output.Addresses[0]
+	}
+
+	BeforeEach(func() {
+		fake = NewFakeEC2()
+		fake.AddNetworkInterface("eni-0", testVpcId, "10.0.0.1", "10.0.0.2")
+		fake.AddNetworkInterface("eni-1", testVpcId, "10.0.1.1")
+	})
+
+	Context("allocating and releasing", func() {
+		It("allocates the EIPs with the tags", func() {
+			first := allocate(&ec2.Tag{Key: aws.String("cluster"), Value: aws.String("test")})
+			second := allocate()
+			Expect(first).NotTo(Equal(second))
+
+			address := describe(first)
+			Expect(aws.StringValue(address.Domain)).To(Equal("vpc"))
+			Expect(aws.StringValue(address.PublicIp)).NotTo(Equal(aws.StringValue(describe(second).PublicIp)))
+			Expect(address.Tags).To(HaveLen(1))
+			Expect(aws.StringValue(address.Tags[0].Value)).To(Equal("test"))
+		})
+
+		It("refuses to release the EIP in use", func() {
+			eipAllocationId := allocate()
+			_, err := associate(eipAllocationId, "eni-0", "10.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = fake.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: aws.String(eipAllocationId)})
+			Expect(errorCode(err)).To(Equal("InvalidIPAddress.InUse"))
+
+			_, err = fake.DisassociateAddress(&ec2.DisassociateAddressInput{
+				AssociationId: describe(eipAllocationId).AssociationId,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = fake.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: aws.String(eipAllocationId)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fake.Addresses()).To(BeEmpty())
+
+			_, err = fake.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: aws.String(eipAllocationId)})
+			Expect(errorCode(err)).To(Equal("InvalidAllocationID.NotFound"))
+		})
+	})
+
+	Context("associating and disassociating", func() {
+		It("associates the EIP with the primary private IP by default", func() {
+			eipAllocationId := allocate()
+
+			output, err := fake.AssociateAddress(&ec2.AssociateAddressInput{
+				AllocationId:       aws.String(eipAllocationId),
+				NetworkInterfaceId: aws.String("eni-0"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			address := describe(eipAllocationId)
+			Expect(aws.StringValue(address.AssociationId)).To(Equal(aws.StringValue(output.AssociationId)))
+			Expect(aws.StringValue(address.NetworkInterfaceId)).To(Equal("eni-0"))
+			Expect(aws.StringValue(address.PrivateIpAddress)).To(Equal("10.0.0.1"))
+		})
+
+		It("refuses the unknown ENI and the private IP not on the ENI", func() {
+			eipAllocationId := allocate()
+
+			_, err := associate(eipAllocationId, "eni-2", "10.0.2.1")
+			Expect(errorCode(err)).To(Equal("InvalidNetworkInterfaceID.NotFound"))
+
+			_, err = associate(eipAllocationId, "eni-1", "10.0.0.1")
+			Expect(errorCode(err)).To(Equal("InvalidParameterValue"))
+
+			_, err = associate("eipalloc-0", "eni-0", "10.0.0.1")
+			Expect(errorCode(err)).To(Equal("InvalidAllocationID.NotFound"))
+		})
+
+		It("reassociates the EIP only if it is allowed", func() {
+			eipAllocationId := allocate()
+			associationId, err := associate(eipAllocationId, "eni-0", "10.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = fake.AssociateAddress(&ec2.AssociateAddressInput{
+				AllocationId:       aws.String(eipAllocationId),
+				NetworkInterfaceId: aws.String("eni-1"),
+				PrivateIpAddress:   aws.String("10.0.1.1"),
+			})
+			Expect(errorCode(err)).To(Equal("Resource.AlreadyAssociated"))
+
+			newAssociationId, err := associate(eipAllocationId, "eni-1", "10.0.1.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(newAssociationId).NotTo(Equal(associationId))
+
+			address := describe(eipAllocationId)
+			Expect(aws.StringValue(address.NetworkInterfaceId)).To(Equal("eni-1"))
+			Expect(aws.StringValue(address.PrivateIpAddress)).To(Equal("10.0.1.1"))
+
+			_, err = fake.DisassociateAddress(&ec2.DisassociateAddressInput{AssociationId: aws.String(associationId)})
+			Expect(errorCode(err)).To(Equal("InvalidAssociationID.NotFound"))
+		})
+
+		It("takes the private IP from the EIP associated with it before", func() {
+			first := allocate()
+			second := allocate()
+			_, err := associate(first, "eni-0", "10.0.0.2")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = associate(second, "eni-0", "10.0.0.2")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(describe(first).AssociationId).To(BeNil())
+			Expect(aws.StringValue(describe(second).PrivateIpAddress)).To(Equal("10.0.0.2"))
+		})
+
+		It("disassociates the EIPs of the ENI removed", func() {
+			eipAllocationId := allocate()
+			_, err := associate(eipAllocationId, "eni-0", "10.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			fake.RemoveNetworkInterface("eni-0")
+
+			address := describe(eipAllocationId)
+			Expect(address.AssociationId).To(BeNil())
+			Expect(address.NetworkInterfaceId).To(BeNil())
+			Expect(address.PrivateIpAddress).To(BeNil())
+
+			_, err = associate(eipAllocationId, "eni-0", "10.0.0.1")
+			Expect(errorCode(err)).To(Equal("InvalidNetworkInterfaceID.NotFound"))
+		})
+	})
+
+	Context("describing", func() {
+		It("filters the EIPs by the tags and the association", func() {
+			owned := allocate(&ec2.Tag{Key: aws.String("cluster"), Value: aws.String("test")})
+			allocate(&ec2.Tag{Key: aws.String("cluster"), Value: aws.String("other")})
+			allocate()
+			_, err := associate(owned, "eni-1", "10.0.1.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := fake.DescribeAddresses(&ec2.DescribeAddressesInput{
+				Filters: []*ec2.Filter{{Name: aws.String("tag:cluster"), Values: []*string{aws.String("test")}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Addresses).To(HaveLen(1))
+			Expect(aws.StringValue(output.Addresses[0].AllocationId)).To(Equal(owned))
+
+			output, err = fake.DescribeAddresses(&ec2.DescribeAddressesInput{
+				Filters: []*ec2.Filter{{Name: aws.String("tag-key"), Values: []*string{aws.String("cluster")}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Addresses).To(HaveLen(2))
+
+			output, err = fake.DescribeAddresses(&ec2.DescribeAddressesInput{
+				Filters: []*ec2.Filter{{Name: aws.String("private-ip-address"), Values: []*string{aws.String("10.0.1.1")}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Addresses).To(HaveLen(1))
+			Expect(aws.StringValue(output.Addresses[0].AllocationId)).To(Equal(owned))
+
+			_, err = fake.DescribeAddresses(&ec2.DescribeAddressesInput{
+				AllocationIds: []*string{aws.String("eipalloc-0")},
+			})
+			Expect(errorCode(err)).To(Equal("InvalidAllocationID.NotFound"))
+		})
+
+		It("returns the copies of the EIPs", func() {
+			eipAllocationId := allocate(&ec2.Tag{Key: aws.String("cluster"), Value: aws.String("test")})
+
+			addresses := fake.Addresses()
+			Expect(addresses).To(HaveLen(1))
+			addresses[0].Tags[0].Value = aws.String("other")
+			addresses[0].PublicIp = nil
+
+			address := describe(eipAllocationId)
+			Expect(aws.StringValue(address.Tags[0].Value)).To(Equal("test"))
+			Expect(address.PublicIp).NotTo(BeNil())
+		})
+
+		It("filters the ENIs by the private IPs", func() {
+			output, err := fake.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+				Filters: []*ec2.Filter{{
+					Name:   aws.String("addresses.private-ip-address"),
+					Values: []*string{aws.String("10.0.0.2")},
+				}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.NetworkInterfaces).To(HaveLen(1))
+			Expect(aws.StringValue(output.NetworkInterfaces[0].NetworkInterfaceId)).To(Equal("eni-0"))
+
+			// only the primary private IP matches the filter
+			output, err = fake.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+				Filters: []*ec2.Filter{{
+					Name:   aws.String("private-ip-address"),
+					Values: []*string{aws.String("10.0.0.2")},
+				}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.NetworkInterfaces).To(BeEmpty())
+
+			output, err = fake.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+				NetworkInterfaceIds: []*string{aws.String("eni-1")},
+				Filters:             []*ec2.Filter{{Name: aws.String("vpc-id"), Values: []*string{aws.String(testVpcId)}}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.NetworkInterfaces).To(HaveLen(1))
+			Expect(aws.StringValue(output.NetworkInterfaces[0].PrivateIpAddress)).To(Equal("10.0.1.1"))
+		})
+
+		It("describes the instances added only", func() {
+			fake.AddInstance("i-0", testVpcId)
+
+			output, err := fake.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String("i-0")}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.Reservations).To(HaveLen(1))
+			Expect(output.Reservations[0].Instances).To(HaveLen(1))
+			Expect(aws.StringValue(output.Reservations[0].Instances[0].VpcId)).To(Equal(testVpcId))
+
+			_, err = fake.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String("i-1")}})
+			Expect(errorCode(err)).To(Equal("InvalidInstanceID.NotFound"))
+		})
+	})
+
+	Context("tagging", func() {
+		It("merges the tags into the EIP", func() {
+			eipAllocationId := allocate(
+				&ec2.Tag{Key: aws.String("cluster"), Value: aws.String("test")},
+				&ec2.Tag{Key: aws.String("pod"), Value: aws.String("pod-0")})
+
+			_, err := fake.CreateTags(&ec2.CreateTagsInput{
+				Resources: []*string{aws.String(eipAllocationId)},
+				Tags: []*ec2.Tag{
+					{Key: aws.String("pod"), Value: aws.String("pod-1")},
+					{Key: aws.String("namespace"), Value: aws.String("ns")},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			tags := make(map[string]string)
+			for _, tag := range describe(eipAllocationId).Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			Expect(tags).To(Equal(map[string]string{"cluster": "test", "pod": "pod-1", "namespace": "ns"}))
+
+			_, err = fake.CreateTags(&ec2.CreateTagsInput{
+				Resources: []*string{aws.String("eipalloc-0")},
+				Tags:      []*ec2.Tag{{Key: aws.String("pod"), Value: aws.String("pod-1")}},
+			})
+			Expect(errorCode(err)).To(Equal("InvalidAllocationID.NotFound"))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package ec2api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/zhiyanliu/eks-pod-eip/internal/metrics"
+)
+
+var _ EC2API = &instrumentedEC2{}
+
+// instrumentedEC2 records the latency and the errors of the requests to the wrapped EC2 API.
+type instrumentedEC2 struct {
+	api EC2API
+}
+
+// NewInstrumented wraps the EC2 API to record the metrics of the requests.
+func NewInstrumented(api EC2API) (EC2API, error) {
+	if api == nil {
+		return nil, fmt.Errorf("ec2 client is not set")
+	}
+
+	return &instrumentedEC2{api: api}, nil
+}
+
+func (c *instrumentedEC2) AllocateAddress(
+	input *ec2.AllocateAddressInput) (output *ec2.AllocateAddressOutput, err error) {
+	defer observe("AllocateAddress", time.Now(), &err)
+	return c.api.AllocateAddress(input)
+}
+
+func (c *instrumentedEC2) ReleaseAddress(
+	input *ec2.ReleaseAddressInput) (output *ec2.ReleaseAddressOutput, err error) {
+	defer observe("ReleaseAddress", time.Now(), &err)
+	return c.api.ReleaseAddress(input)
+}
+
+func (c *instrumentedEC2) AssociateAddress(
+	input *ec2.AssociateAddressInput) (output *ec2.AssociateAddressOutput, err error) {
+	defer observe("AssociateAddress", time.Now(), &err)
+	return c.api.AssociateAddress(input)
+}
+
+func (c *instrumentedEC2) DisassociateAddress(
+	input *ec2.DisassociateAddressInput) (output *ec2.DisassociateAddressOutput, err error) {
+	defer observe("DisassociateAddress", time.Now(), &err)
+	return c.api.DisassociateAddress(input)
+}
+
+func (c *instrumentedEC2) DescribeAddresses(
+	input *ec2.DescribeAddressesInput) (output *ec2.DescribeAddressesOutput, err error) {
+	defer observe("DescribeAddresses", time.Now(), &err)
+	return c.api.DescribeAddresses(input)
+}
+
+func (c *instrumentedEC2) DescribeNetworkInterfaces(
+	input *ec2.DescribeNetworkInterfacesInput) (output *ec2.DescribeNetworkInterfacesOutput, err error) {
+	defer observe("DescribeNetworkInterfaces", time.Now(), &err)
+	return c.api.DescribeNetworkInterfaces(input)
+}
+
+func (c *instrumentedEC2) DescribeInstances(
+	input *ec2.DescribeInstancesInput) (output *ec2.DescribeInstancesOutput, err error) {
+	defer observe("DescribeInstances", time.Now(), &err)
+	return c.api.DescribeInstances(input)
+}
+
+func (c *instrumentedEC2) CreateTags(
+	input *ec2.CreateTagsInput) (output *ec2.CreateTagsOutput, err error) {
+	defer observe("CreateTags", time.Now(), &err)
+	return c.api.CreateTags(input)
+}
+
+func observe(operation string, start time.Time, err *error) {
+	metrics.ObserveEC2Request(operation, time.Since(start), *err)
+}
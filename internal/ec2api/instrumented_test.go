@@ -0,0 +1,42 @@
+package ec2api
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var _ = Describe("Instrumented EC2", func() {
+	It("refuses to wrap no EC2 API", func() {
+		_, err := NewInstrumented(nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("passes the requests through and counts the failed ones by the aws error code", func() {
+		fake := NewFakeEC2()
+		api, err := NewInstrumented(fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		output, err := api.AllocateAddress(&ec2.AllocateAddressInput{Domain: aws.String("vpc")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.Addresses()).To(HaveLen(1))
+
+		_, err = api.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: output.AllocationId})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = api.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: output.AllocationId})
+		Expect(errorCode(err)).To(Equal("InvalidAllocationID.NotFound"))
+
+		expected := `
+# HELP eks_pod_eip_ec2_request_errors_total Number of the failed aws EC2 API requests, by the operation and the aws error code.
+# TYPE eks_pod_eip_ec2_request_errors_total counter
+eks_pod_eip_ec2_request_errors_total{code="InvalidAllocationID.NotFound",operation="ReleaseAddress"} 1
+`
+		Expect(testutil.GatherAndCompare(ctrlmetrics.Registry, strings.NewReader(expected),
+			"eks_pod_eip_ec2_request_errors_total")).To(Succeed())
+	})
+})
@@ -0,0 +1,14 @@
+package ec2api
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestEC2API(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "EC2 API Suite")
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+// PodEipAllocationEnabled checks if the EIP is allocated to the pod.
+func PodEipAllocationEnabled(pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy) bool {
+	if value, exists := pod.GetLabels()[PodEipAllocationEnabledLabel]; exists && (value == "true" || value == "false") {
+		return value == "true"
+	}
+
+	if policy != nil {
+		return true
+	}
+
+	if ns.GetLabels()[NamespacePodEipAllocationEnabledLabel] != "true" {
+		return false
+	}
+
+	value, exists := ns.GetAnnotations()[NamespacePodEipPodSelectorAnnotation]
+	if !exists {
+		return true
+	}
+
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	return selector.Matches(labels.Set(pod.GetLabels()))
+}
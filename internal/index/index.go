@@ -0,0 +1,61 @@
+package index
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+)
+
+const (
+	// AssociationEipAllocationIdField indexes the EksPodEipAssociations by the EIP allocation ids of all bindings.
+	AssociationEipAllocationIdField = "spec.eipAllocationId"
+	// PodEipAllocationIdField indexes the pods by the EIP allocation ids in the annotation.
+	PodEipAllocationIdField = "metadata.annotations.eipAllocationId"
+	// PodEipCandidateField indexes by "true" the pods that might need an association created or released.
+	PodEipCandidateField = "eipCandidate"
+)
+
+// SetupIndexes adds the field indexes used to look up the EIP claims to the cache.
+func SetupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &ekspodeipv1.EksPodEipAssociation{}, AssociationEipAllocationIdField,
+		func(obj client.Object) []string {
+			eipAssociation := obj.(*ekspodeipv1.EksPodEipAssociation)
+
+			var eipAllocationIds []string
+			for _, binding := range eipAssociation.Spec.Bindings() {
+				if binding.EipAllocationId != "" {
+					eipAllocationIds = append(eipAllocationIds, binding.EipAllocationId)
+				}
+			}
+			return eipAllocationIds
+		}); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &corev1.Pod{}, PodEipAllocationIdField,
+		func(obj client.Object) []string {
+			return ipam.PodEipAllocationIds(obj.(*corev1.Pod))
+		}); err != nil {
+		return err
+	}
+
+	return indexer.IndexField(ctx, &corev1.Pod{}, PodEipCandidateField,
+		func(obj client.Object) []string {
+			pod := obj.(*corev1.Pod)
+
+			for _, finalizer := range pod.Finalizers {
+				if finalizer == internal.PodEipFinalizer {
+					return []string{"true"}
+				}
+			}
+			if pod.Spec.HostNetwork || ipam.PodIPv4(pod) == "" {
+				return nil
+			}
+			return []string{"true"}
+		})
+}
@@ -0,0 +1,553 @@
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+const (
+	DefaultStoreName = "eks-pod-eip-ipam"
+
+	// storeShards is the number of ConfigMaps per store, changing it loses the existing records.
+	storeShards = 16
+
+	storeTimeout = time.Second * 30
+)
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update;delete
+
+var _ IPAddressStore = &ConfigMapIPAddressStore{}
+
+// ConfigMapIPAddressStore persists the EIP allocations in ConfigMaps sharded by the allocation id.
+type ConfigMapIPAddressStore struct {
+	client    client.Client
+	namespace string
+	name      string
+
+	migrateLock sync.Mutex
+	migrated    bool
+}
+
+type podRecord struct {
+	PodNamespace string `json:"podNamespace"`
+	PodName      string `json:"podName"`
+	PodIP        string `json:"podIP,omitempty"`
+	// ReservationToken identifies the pod the EIP is reserved for before the pod name is known
+	ReservationToken string           `json:"reservationToken,omitempty"`
+	Retention        *retentionRecord `json:"retention,omitempty"`
+}
+
+// retentionRecord is set while the EIP is retained for the pod.
+type retentionRecord struct {
+	Since         time.Time                    `json:"since"`
+	StatefulSet   string                       `json:"statefulSet,omitempty"`
+	ReleasePolicy ekspodeipv1.EipReleasePolicy `json:"releasePolicy,omitempty"`
+}
+
+func NewConfigMapIPAddressStore(c client.Client, namespace, name string) (*ConfigMapIPAddressStore, error) {
+	if c == nil {
+		return nil, fmt.Errorf("client is not set")
+	}
+	if namespace == "" || name == "" {
+		return nil, fmt.Errorf("namespace and name of the ConfigMap are required")
+	}
+
+	return &ConfigMapIPAddressStore{
+		client:    c,
+		namespace: namespace,
+		name:      name,
+	}, nil
+}
+
+func (s *ConfigMapIPAddressStore) AssociateEIPAllocationId(
+	podNamespace, podName, podIP, eipAllocationId string) (string, error) {
+
+	err := s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		if record, exists := decodePodRecord(data[eipAllocationId]); exists && !record.heldBy(podNamespace, podName, "") {
+			return false, record.heldError(eipAllocationId)
+		}
+
+		value := encodePodRecord(podRecord{
+			PodNamespace: podNamespace,
+			PodName:      podName,
+			PodIP:        podIP,
+		})
+		if data[eipAllocationId] == value {
+			return false, nil
+		}
+		data[eipAllocationId] = value
+
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return eipAllocationId, nil
+}
+
+func (s *ConfigMapIPAddressStore) ReserveEIPAllocationId(podNamespace, token, eipAllocationId string) error {
+	if token == "" {
+		return fmt.Errorf("reservation token is empty")
+	}
+
+	return s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		record, exists := decodePodRecord(data[eipAllocationId])
+		if exists && !record.heldBy(podNamespace, "", token) {
+			return false, record.heldError(eipAllocationId)
+		}
+		if exists {
+			return false, nil
+		}
+
+		data[eipAllocationId] = encodePodRecord(podRecord{
+			PodNamespace:     podNamespace,
+			ReservationToken: token,
+		})
+
+		return true, nil
+	})
+}
+
+func (s *ConfigMapIPAddressStore) ClaimEIPAllocationId(
+	podNamespace, podName, podIP, token, eipAllocationId string) error {
+
+	return s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		if record, exists := decodePodRecord(data[eipAllocationId]); exists &&
+			!record.heldBy(podNamespace, podName, token) {
+			return false, record.heldError(eipAllocationId)
+		}
+
+		value := encodePodRecord(podRecord{
+			PodNamespace: podNamespace,
+			PodName:      podName,
+			PodIP:        podIP,
+		})
+		if data[eipAllocationId] == value {
+			return false, nil
+		}
+		data[eipAllocationId] = value
+
+		return true, nil
+	})
+}
+
+func (s *ConfigMapIPAddressStore) ReleaseEIPAllocationId(
+	podNamespace, podName, podIP, eipAllocationId string) (string, error) {
+
+	if eipAllocationId == "" {
+		var err error
+		if eipAllocationId, err = s.GetAssociatedEIPAllocationId(podNamespace, podName, "", ""); err != nil {
+			return "", err
+		}
+		if eipAllocationId == "" {
+			return "", nil
+		}
+	}
+
+	var released string
+
+	err := s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		released = ""
+
+		record, exists := decodePodRecord(data[eipAllocationId])
+		if !exists || !record.heldBy(podNamespace, podName, "") {
+			// released or taken by others in the meantime
+			return false, nil
+		}
+
+		data[eipAllocationId] = ""
+		released = eipAllocationId
+
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return released, nil
+}
+
+func (s *ConfigMapIPAddressStore) RemoveEIPAllocationId(eipAllocationId string) error {
+	return s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		if _, exists := data[eipAllocationId]; !exists {
+			return false, nil
+		}
+		delete(data, eipAllocationId)
+		return true, nil
+	})
+}
+
+func (s *ConfigMapIPAddressStore) RetainEIPAllocationId(eipAllocationId string, retention Retention) error {
+	return s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		record, exists := decodePodRecord(data[eipAllocationId])
+		if !exists || !record.heldBy(retention.PodNamespace, retention.PodName, "") {
+			// not recorded for the pod, nothing to retain
+			return false, nil
+		}
+		if record.Retention != nil {
+			// keep the time the retention starts
+			return false, nil
+		}
+
+		record.Retention = &retentionRecord{
+			Since:         retention.Since,
+			StatefulSet:   retention.StatefulSet,
+			ReleasePolicy: retention.ReleasePolicy,
+		}
+		data[eipAllocationId] = encodePodRecord(record)
+
+		return true, nil
+	})
+}
+
+func (s *ConfigMapIPAddressStore) ReleaseRetainedEIPAllocationId(eipAllocationId string, remove bool) (bool, error) {
+	var released bool
+
+	err := s.mutate(eipAllocationId, func(data map[string]string) (bool, error) {
+		released = false
+
+		if record, exists := decodePodRecord(data[eipAllocationId]); !exists || record.Retention == nil {
+			// reused by the replacement pod in the meantime
+			return false, nil
+		}
+
+		if remove {
+			delete(data, eipAllocationId)
+		} else {
+			data[eipAllocationId] = ""
+		}
+		released = true
+
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return released, nil
+}
+
+func (s *ConfigMapIPAddressStore) SyncEIPAllocationIds(eipAllocationIds []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := s.migrate(ctx); err != nil {
+		return err
+	}
+
+	expected := make([]map[string]bool, storeShards)
+	for shard := range expected {
+		expected[shard] = make(map[string]bool)
+	}
+	for _, allocationId := range eipAllocationIds {
+		expected[shardOf(allocationId)][allocationId] = true
+	}
+
+	for shard := 0; shard < storeShards; shard++ {
+		err := s.mutateShard(ctx, shard, func(data map[string]string) (bool, error) {
+			changed := false
+
+			for allocationId := range expected[shard] {
+				if _, exists := data[allocationId]; !exists {
+					data[allocationId] = ""
+					changed = true
+				}
+			}
+
+			// the EIP in use is kept until it is released by the pod
+			for allocationId, value := range data {
+				if _, associated := decodePodRecord(value); !expected[shard][allocationId] && !associated {
+					delete(data, allocationId)
+					changed = true
+				}
+			}
+
+			return changed, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ConfigMapIPAddressStore) GetAssociatedEIPAllocationId(
+	podNamespace, podName, podIP, eipAllocationId string) (string, error) {
+
+	data, err := s.load()
+	if err != nil {
+		return "", err
+	}
+
+	for _, allocationId := range sortedKeys(data) {
+		if eipAllocationId != "" && allocationId != eipAllocationId {
+			continue
+		}
+		if record, exists := decodePodRecord(data[allocationId]); exists &&
+			record.PodNamespace == podNamespace && record.PodName == podName &&
+			(podIP == "" || record.PodIP == podIP) {
+			return allocationId, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (s *ConfigMapIPAddressStore) GetAllAssociatedEIPAllocationIds() ([]string, error) {
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var allocationIds []string
+	for _, allocationId := range sortedKeys(data) {
+		if _, exists := decodePodRecord(data[allocationId]); exists {
+			allocationIds = append(allocationIds, allocationId)
+		}
+	}
+
+	return allocationIds, nil
+}
+
+func (s *ConfigMapIPAddressStore) GetAvailableEIPAllocationIds() ([]string, error) {
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var allocationIds []string
+	for _, allocationId := range sortedKeys(data) {
+		if _, exists := decodePodRecord(data[allocationId]); !exists {
+			allocationIds = append(allocationIds, allocationId)
+		}
+	}
+
+	return allocationIds, nil
+}
+
+func (s *ConfigMapIPAddressStore) GetRetainedEIPAllocationIds() (map[string]Retention, error) {
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	retained := make(map[string]Retention)
+	for allocationId, value := range data {
+		if record, exists := decodePodRecord(value); exists && record.Retention != nil {
+			retained[allocationId] = Retention{
+				PodNamespace:  record.PodNamespace,
+				PodName:       record.PodName,
+				Since:         record.Retention.Since,
+				StatefulSet:   record.Retention.StatefulSet,
+				ReleasePolicy: record.Retention.ReleasePolicy,
+			}
+		}
+	}
+
+	return retained, nil
+}
+
+// load returns the records of all shards.
+func (s *ConfigMapIPAddressStore) load() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]string)
+	for shard := 0; shard < storeShards; shard++ {
+		var configMap corev1.ConfigMap
+		err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: s.shardName(shard)}, &configMap)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to fetch ConfigMap %s/%s: %v", s.namespace, s.shardName(shard), err)
+		}
+
+		for allocationId, value := range configMap.Data {
+			data[allocationId] = value
+		}
+	}
+
+	return data, nil
+}
+
+// mutate updates the shard recording the EIP, the other EIPs are updated in parallel.
+func (s *ConfigMapIPAddressStore) mutate(eipAllocationId string, fn func(data map[string]string) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := s.migrate(ctx); err != nil {
+		return err
+	}
+
+	return s.mutateShard(ctx, shardOf(eipAllocationId), fn)
+}
+
+// mutateShard updates the shard by fn, the ConfigMap is written only if fn reports the records changed.
+func (s *ConfigMapIPAddressStore) mutateShard(
+	ctx context.Context, shard int, fn func(data map[string]string) (bool, error)) error {
+
+	name := s.shardName(shard)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var configMap corev1.ConfigMap
+		err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: name}, &configMap)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to fetch ConfigMap %s/%s: %v", s.namespace, name, err)
+		}
+		notFound := err != nil
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+
+		changed, err := fn(configMap.Data)
+		if err != nil || !changed {
+			return err
+		}
+
+		if notFound {
+			configMap.Namespace = s.namespace
+			configMap.Name = name
+			if err = s.client.Create(ctx, &configMap); apierrors.IsAlreadyExists(err) {
+				// created by others in the meantime, retry as a conflict
+				return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+
+		return s.client.Update(ctx, &configMap)
+	})
+}
+
+// migrate moves the records written before the store was sharded into the shards.
+func (s *ConfigMapIPAddressStore) migrate(ctx context.Context) error {
+	s.migrateLock.Lock()
+	defer s.migrateLock.Unlock()
+
+	if s.migrated {
+		return nil
+	}
+
+	var configMap corev1.ConfigMap
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: s.name}, &configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			s.migrated = true
+			return nil
+		}
+		return fmt.Errorf("unable to fetch ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+
+	shardData := make([]map[string]string, storeShards)
+	for allocationId, value := range configMap.Data {
+		shard := shardOf(allocationId)
+		if shardData[shard] == nil {
+			shardData[shard] = make(map[string]string)
+		}
+		shardData[shard][allocationId] = value
+	}
+
+	for shard, records := range shardData {
+		if records == nil {
+			continue
+		}
+
+		err := s.mutateShard(ctx, shard, func(data map[string]string) (bool, error) {
+			changed := false
+			for allocationId, value := range records {
+				if _, exists := data[allocationId]; !exists {
+					data[allocationId] = value
+					changed = true
+				}
+			}
+			return changed, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to migrate ConfigMap %s/%s: %v", s.namespace, s.name, err)
+		}
+	}
+
+	if err := s.client.Delete(ctx, &configMap); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete migrated ConfigMap %s/%s: %v", s.namespace, s.name, err)
+	}
+
+	s.migrated = true
+
+	return nil
+}
+
+func (s *ConfigMapIPAddressStore) shardName(shard int) string {
+	return fmt.Sprintf("%s-%d", s.name, shard)
+}
+
+func shardOf(eipAllocationId string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(eipAllocationId))
+	return int(h.Sum32() % storeShards)
+}
+
+// heldBy returns whether the EIP is associated with the pod, or reserved for the pod carrying the token.
+func (r podRecord) heldBy(podNamespace, podName, token string) bool {
+	if r.PodNamespace != podNamespace {
+		return false
+	}
+	if r.PodName != "" {
+		return r.PodName == podName
+	}
+
+	return r.ReservationToken != "" && r.ReservationToken == token
+}
+
+func (r podRecord) heldError(eipAllocationId string) error {
+	if r.PodName == "" {
+		return &HeldError{EipAllocationId: eipAllocationId,
+			Reason: fmt.Sprintf("reserved for another pod in namespace %s", r.PodNamespace)}
+	}
+
+	return &HeldError{EipAllocationId: eipAllocationId,
+		Reason: fmt.Sprintf("associated with pod %s/%s already", r.PodNamespace, r.PodName)}
+}
+
+func encodePodRecord(record podRecord) string {
+	value, _ := json.Marshal(record)
+	return string(value)
+}
+
+func decodePodRecord(value string) (podRecord, bool) {
+	var record podRecord
+	if value == "" {
+		return record, false
+	}
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return record, false
+	}
+	return record, true
+}
+
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,187 @@
+package ipam
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	testStoreNamespace = "eks-pod-eip-system"
+	testStoreName      = "test-store"
+)
+
+// conflictingClient fails the next updates with a conflict, as if the ConfigMap is written by others.
+type conflictingClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return apierrors.NewConflict(corev1.Resource("configmaps"), obj.GetName(), fmt.Errorf("conflict"))
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+var _ = Describe("ConfigMapIPAddressStore", func() {
+	var (
+		c     *conflictingClient
+		store *ConfigMapIPAddressStore
+	)
+
+	BeforeEach(func() {
+		c = &conflictingClient{Client: fake.NewClientBuilder().Build()}
+		var err error
+		store, err = NewConfigMapIPAddressStore(c, testStoreNamespace, testStoreName)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("associating EIPs", func() {
+		It("records the EIP for the pod and finds it by the pod and the private IP", func() {
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.1", "eipalloc-1")).To(Equal("eipalloc-1"))
+
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "", "")).To(Equal("eipalloc-1"))
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "10.0.0.1", "")).To(Equal("eipalloc-1"))
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "10.0.0.2", "")).To(BeEmpty())
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-1", "", "")).To(BeEmpty())
+			Expect(store.GetAllAssociatedEIPAllocationIds()).To(Equal([]string{"eipalloc-1"}))
+			Expect(store.GetAvailableEIPAllocationIds()).To(BeEmpty())
+		})
+
+		It("refuses the EIP associated with another pod", func() {
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.1", "eipalloc-1")).To(Equal("eipalloc-1"))
+
+			_, err := store.AssociateEIPAllocationId("ns", "pod-1", "10.0.0.2", "eipalloc-1")
+			Expect(err).To(HaveOccurred())
+
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "10.0.0.1", "")).To(Equal("eipalloc-1"))
+		})
+
+		It("lets only the pod carrying the reservation token claim the EIP reserved", func() {
+			Expect(store.ReserveEIPAllocationId("ns", "token-a", "eipalloc-1")).To(Succeed())
+
+			_, err := store.AssociateEIPAllocationId("ns", "pod-1", "10.0.0.2", "eipalloc-1")
+			Expect(err).To(BeAssignableToTypeOf(&HeldError{}))
+			Expect(store.ReserveEIPAllocationId("ns", "token-b", "eipalloc-1")).NotTo(Succeed())
+			Expect(store.ClaimEIPAllocationId("ns", "pod-1", "10.0.0.2", "token-b", "eipalloc-1")).NotTo(Succeed())
+			Expect(store.ClaimEIPAllocationId("other", "pod-0", "10.0.0.1", "token-a", "eipalloc-1")).NotTo(Succeed())
+			Expect(store.ReleaseEIPAllocationId("ns", "pod-1", "", "eipalloc-1")).To(BeEmpty())
+
+			Expect(store.ClaimEIPAllocationId("ns", "pod-0", "10.0.0.1", "token-a", "eipalloc-1")).To(Succeed())
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "", "")).To(Equal("eipalloc-1"))
+
+			// the claimed EIP is held by the pod name, the token is not needed any more
+			Expect(store.ClaimEIPAllocationId("ns", "pod-0", "10.0.0.1", "", "eipalloc-1")).To(Succeed())
+			Expect(store.ClaimEIPAllocationId("ns", "pod-1", "10.0.0.2", "token-a", "eipalloc-1")).NotTo(Succeed())
+		})
+
+		It("retries the update on the conflict", func() {
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.1", "eipalloc-1")).To(Equal("eipalloc-1"))
+
+			c.conflicts = 2
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.2", "eipalloc-1")).To(Equal("eipalloc-1"))
+			Expect(c.conflicts).To(BeZero())
+
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "10.0.0.2", "")).To(Equal("eipalloc-1"))
+		})
+	})
+
+	Context("releasing EIPs", func() {
+		BeforeEach(func() {
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.1", "eipalloc-1")).To(Equal("eipalloc-1"))
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.2", "eipalloc-2")).To(Equal("eipalloc-2"))
+			Expect(store.AssociateEIPAllocationId("ns", "pod-1", "10.0.0.3", "eipalloc-3")).To(Equal("eipalloc-3"))
+		})
+
+		It("makes the EIP released by the allocation id available", func() {
+			Expect(store.ReleaseEIPAllocationId("ns", "pod-0", "10.0.0.2", "eipalloc-2")).To(Equal("eipalloc-2"))
+
+			Expect(store.GetAvailableEIPAllocationIds()).To(Equal([]string{"eipalloc-2"}))
+			Expect(store.GetAllAssociatedEIPAllocationIds()).To(Equal([]string{"eipalloc-1", "eipalloc-3"}))
+		})
+
+		It("releases an EIP of the pod without the allocation id", func() {
+			Expect(store.ReleaseEIPAllocationId("ns", "pod-1", "", "")).To(Equal("eipalloc-3"))
+			Expect(store.ReleaseEIPAllocationId("ns", "pod-1", "", "")).To(BeEmpty())
+		})
+
+		It("doesn't release the EIP of another pod", func() {
+			Expect(store.ReleaseEIPAllocationId("ns", "pod-1", "", "eipalloc-1")).To(BeEmpty())
+			Expect(store.ReleaseEIPAllocationId("other", "pod-0", "", "")).To(BeEmpty())
+
+			Expect(store.GetAvailableEIPAllocationIds()).To(BeEmpty())
+		})
+
+		It("removes the EIP from the store", func() {
+			Expect(store.RemoveEIPAllocationId("eipalloc-1")).To(Succeed())
+			Expect(store.RemoveEIPAllocationId("eipalloc-1")).To(Succeed())
+
+			Expect(store.GetAllAssociatedEIPAllocationIds()).To(Equal([]string{"eipalloc-2", "eipalloc-3"}))
+		})
+	})
+
+	Context("syncing EIPs", func() {
+		It("adds the new EIPs and drops the available ones no longer expected", func() {
+			Expect(store.SyncEIPAllocationIds([]string{"eipalloc-1", "eipalloc-2", "eipalloc-3"})).To(Succeed())
+			Expect(store.GetAvailableEIPAllocationIds()).To(Equal([]string{"eipalloc-1", "eipalloc-2", "eipalloc-3"}))
+
+			Expect(store.AssociateEIPAllocationId("ns", "pod-0", "10.0.0.1", "eipalloc-1")).To(Equal("eipalloc-1"))
+
+			Expect(store.SyncEIPAllocationIds([]string{"eipalloc-3", "eipalloc-4"})).To(Succeed())
+			Expect(store.GetAvailableEIPAllocationIds()).To(Equal([]string{"eipalloc-3", "eipalloc-4"}))
+			// the EIP in use is kept until the pod releases it
+			Expect(store.GetAllAssociatedEIPAllocationIds()).To(Equal([]string{"eipalloc-1"}))
+		})
+	})
+
+	Context("sharding", func() {
+		It("spreads the records over the ConfigMaps", func() {
+			var eipAllocationIds []string
+			for i := 0; i < 64; i++ {
+				eipAllocationIds = append(eipAllocationIds, fmt.Sprintf("eipalloc-%017x", i))
+			}
+			Expect(store.SyncEIPAllocationIds(eipAllocationIds)).To(Succeed())
+
+			var configMaps corev1.ConfigMapList
+			Expect(c.List(context.Background(), &configMaps, client.InNamespace(testStoreNamespace))).To(Succeed())
+			Expect(len(configMaps.Items)).To(BeNumerically(">", 1))
+			Expect(len(configMaps.Items)).To(BeNumerically("<=", storeShards))
+
+			total := 0
+			for _, configMap := range configMaps.Items {
+				for eipAllocationId := range configMap.Data {
+					Expect(configMap.Name).To(Equal(store.shardName(shardOf(eipAllocationId))))
+					total++
+				}
+			}
+			Expect(total).To(Equal(len(eipAllocationIds)))
+		})
+
+		It("migrates the records of the unsharded ConfigMap", func() {
+			Expect(c.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testStoreNamespace, Name: testStoreName},
+				Data: map[string]string{
+					"eipalloc-1": encodePodRecord(podRecord{PodNamespace: "ns", PodName: "pod-0"}),
+					"eipalloc-2": "",
+				},
+			})).To(Succeed())
+
+			Expect(store.GetAssociatedEIPAllocationId("ns", "pod-0", "", "")).To(Equal("eipalloc-1"))
+			Expect(store.GetAvailableEIPAllocationIds()).To(Equal([]string{"eipalloc-2"}))
+
+			err := c.Get(context.Background(),
+				types.NamespacedName{Namespace: testStoreNamespace, Name: testStoreName}, &corev1.ConfigMap{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
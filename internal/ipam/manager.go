@@ -1,45 +1,690 @@
 package ipam
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
 	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
 )
 
 type IPAddressManager struct {
-	awsSession *session.Session
-	vpcId      string
+	ec2Svc      ec2api.EC2API
+	vpcId       string
+	clusterName string
+	store       IPAddressStore
+
+	newStore   func(name string) (IPAddressStore, error)
+	poolStores map[string]IPAddressStore
+	poolLock   sync.Mutex
+	poolEvents chan event.GenericEvent
 }
 
-func NewIPAddressManager(awsSession *session.Session) *IPAddressManager {
-	if awsSession == nil {
-		panic("aws session is nil")
+const (
+	// the pool changes beyond it are dropped, the pool status is refreshed by the periodic resync then
+	poolEventsBufferSize = 1024
+)
+
+// NewIPAddressManager creates the manager with the default store and a store per EipPool.
+func NewIPAddressManager(ec2Svc ec2api.EC2API, vpcId, clusterName string,
+	newStore func(name string) (IPAddressStore, error)) (*IPAddressManager, error) {
+
+	if ec2Svc == nil {
+		return nil, fmt.Errorf("ec2 client is not set")
+	}
+	if vpcId == "" {
+		return nil, fmt.Errorf("vpc id is empty")
+	}
+	if clusterName == "" {
+		// the EIPs of other clusters in the same vpc can't be told apart without the cluster tag
+		return nil, fmt.Errorf("cluster name is empty")
+	}
+	if newStore == nil {
+		return nil, fmt.Errorf("ip address store creator is not set")
+	}
+
+	store, err := newStore(DefaultStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the default store: %v", err)
 	}
 
 	return &IPAddressManager{
-		awsSession: awsSession,
+		ec2Svc:      ec2Svc,
+		vpcId:       vpcId,
+		clusterName: clusterName,
+		store:       store,
+		newStore:    newStore,
+		poolStores:  make(map[string]IPAddressStore),
+		poolEvents:  make(chan event.GenericEvent, poolEventsBufferSize),
+	}, nil
+}
+
+// PoolEvents returns the events of the EipPools whose EIPs are drawn or returned.
+func (m *IPAddressManager) PoolEvents() <-chan event.GenericEvent {
+	return m.poolEvents
+}
+
+// PoolStoreName returns the name of the store recording the EIPs of the pool.
+func PoolStoreName(pool string) string {
+	return fmt.Sprintf("eks-pod-eip-pool-%s", pool)
+}
+
+// PodEipPool returns the name of the EipPool the EIP of the pod is drawn from.
+func PodEipPool(pod *corev1.Pod, ns *corev1.Namespace, policy *ekspodeipv1.EipPolicy) string {
+	if pool, exists := pod.GetAnnotations()[internal.PodEipPoolAnnotation]; exists {
+		return pool
+	}
+	if policy != nil && policy.Spec.EipPool != "" {
+		return policy.Spec.EipPool
+	}
+
+	return ns.GetAnnotations()[internal.NamespacePodEipDefaultPoolAnnotation]
+}
+
+// PodEipAllocationIds returns the EIP allocation ids specified by the pod annotation.
+func PodEipAllocationIds(pod *corev1.Pod) []string {
+	value, exists := pod.GetAnnotations()[internal.PodEipAllocationIdAnnotation]
+	if !exists {
+		return nil
+	}
+
+	var eipAllocationIds []string
+	for _, eipAllocationId := range strings.Split(value, ",") {
+		if eipAllocationId = strings.TrimSpace(eipAllocationId); eipAllocationId != "" {
+			eipAllocationIds = append(eipAllocationIds, eipAllocationId)
+		}
+	}
+
+	return eipAllocationIds
+}
+
+// PodIPv4 returns the IPv4 address of the pod.
+func PodIPv4(pod *corev1.Pod) string {
+	for _, podIP := range pod.Status.PodIPs {
+		if ip := net.ParseIP(podIP.IP); ip != nil && ip.To4() != nil {
+			return podIP.IP
+		}
+	}
+
+	if ip := net.ParseIP(pod.Status.PodIP); ip != nil && ip.To4() != nil {
+		return pod.Status.PodIP
+	}
+
+	return ""
+}
+
+// ReserveEip reserves an EIP for the reservation token of the pod being admitted.
+func (m *IPAddressManager) ReserveEip(pod *corev1.Pod, pool string) (string, error) {
+	if podReservationToken(pod) == "" {
+		return "", fmt.Errorf("no reservation token annotated on the pod")
 	}
+
+	if pool != "" {
+		return m.allocatePoolEip(pod, pool)
+	}
+
+	eipAllocationId, err := m.reuseEip(m.store, pod)
+	if err != nil || eipAllocationId != "" {
+		return eipAllocationId, err
+	}
+
+	eipAllocationId, err = m.drawEip(m.store, pod, "")
+	if err != nil || eipAllocationId != "" {
+		return eipAllocationId, err
+	}
+
+	return m.createAwsEip(pod, "", internal.EipRolePrimary)
+}
+
+// AllocateEip returns the EIP allocation id for the pod, and whether the controller allocated it.
+func (m *IPAddressManager) AllocateEip(pod *corev1.Pod, pool, associationName string) (string, bool, error) {
+	if preferredEIPAllocationIds := PodEipAllocationIds(pod); len(preferredEIPAllocationIds) > 0 {
+		if podEipReserved(pod) {
+			return m.claimEip(pod, pool, associationName, preferredEIPAllocationIds[0])
+		}
+		return preferredEIPAllocationIds[0], false, nil
+	}
+
+	if pool != "" {
+		eipAllocationId, err := m.allocatePoolEip(pod, pool)
+		return eipAllocationId, false, err
+	}
+
+	// reuse the EIP recorded for the pod, e.g. after a restart or a retention
+	eipAllocationId, err := m.reuseEip(m.store, pod)
+	if err != nil {
+		return "", false, err
+	}
+	if eipAllocationId != "" {
+		return eipAllocationId, true, nil
+	}
+
+	// adopt the EIP tagged for the pod but not recorded, e.g. the controller crashed after the allocation
+	eipAllocationId, err = m.findAwsEip(pod)
+	if err != nil {
+		return "", false, err
+	}
+	if eipAllocationId != "" {
+		if _, err = m.store.AssociateEIPAllocationId(
+			pod.GetNamespace(), pod.GetName(), PodIPv4(pod), eipAllocationId); err != nil {
+			return "", false, fmt.Errorf("unable to record EIP %s: %v", eipAllocationId, err)
+		}
+		return eipAllocationId, true, nil
+	}
+
+	// take the EIP returned to the pool by other pods
+	eipAllocationId, err = m.drawEip(m.store, pod, PodIPv4(pod))
+	if err != nil {
+		return "", false, err
+	}
+	if eipAllocationId != "" {
+		if err = m.tagAwsEip(eipAllocationId, pod, associationName, internal.EipRolePrimary); err != nil {
+			return "", false, fmt.Errorf("unable to tag EIP %s: %v", eipAllocationId, err)
+		}
+		return eipAllocationId, true, nil
+	}
+
+	eipAllocationId, err = m.createAwsEip(pod, associationName, internal.EipRolePrimary)
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err = m.store.AssociateEIPAllocationId(
+		pod.GetNamespace(), pod.GetName(), PodIPv4(pod), eipAllocationId); err != nil {
+		if releaseErr := m.deleteAwsEip(eipAllocationId); releaseErr != nil {
+			return "", false, fmt.Errorf("unable to record EIP %s: %v, and unable to release it: %v",
+				eipAllocationId, err, releaseErr)
+		}
+		return "", false, fmt.Errorf("unable to record EIP %s: %v", eipAllocationId, err)
+	}
+
+	return eipAllocationId, true, nil
 }
 
-func (m *IPAddressManager) AllocateEip(pod *corev1.Pod) (string, error) {
-	if preferredEIPAllocationId, exists := pod.GetAnnotations()[internal.PodEipAllocationIdAnnotation]; exists {
-		return preferredEIPAllocationId, nil
+// AllocateSecondaryEip returns the EIP allocation id for the secondary private IP of the pod.
+func (m *IPAddressManager) AllocateSecondaryEip(
+	pod *corev1.Pod, pool, associationName, privateIP string) (string, error) {
+
+	store, err := m.storeOf(pool)
+	if err != nil {
+		return "", err
 	}
-	return m.createAwsEip()
+
+	eipAllocationId, err := store.GetAssociatedEIPAllocationId(pod.GetNamespace(), pod.GetName(), privateIP, "")
+	if err != nil || eipAllocationId != "" {
+		return eipAllocationId, err
+	}
+
+	if pool != "" {
+		eipAllocationId, err = m.drawEip(store, pod, privateIP)
+		if err != nil {
+			return "", err
+		}
+		if eipAllocationId == "" {
+			return "", fmt.Errorf("no EIP available in pool %s", pool)
+		}
+		m.notifyPool(pool)
+		return eipAllocationId, nil
+	}
+
+	eipAllocationId, err = m.drawEip(m.store, pod, privateIP)
+	if err != nil {
+		return "", err
+	}
+	if eipAllocationId != "" {
+		if err = m.tagAwsEip(eipAllocationId, pod, associationName, internal.EipRoleSecondary); err != nil {
+			return "", fmt.Errorf("unable to tag EIP %s: %v", eipAllocationId, err)
+		}
+		return eipAllocationId, nil
+	}
+
+	eipAllocationId, err = m.createAwsEip(pod, associationName, internal.EipRoleSecondary)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = m.store.AssociateEIPAllocationId(
+		pod.GetNamespace(), pod.GetName(), privateIP, eipAllocationId); err != nil {
+		if releaseErr := m.deleteAwsEip(eipAllocationId); releaseErr != nil {
+			return "", fmt.Errorf("unable to record EIP %s: %v, and unable to release it: %v",
+				eipAllocationId, err, releaseErr)
+		}
+		return "", fmt.Errorf("unable to record EIP %s: %v", eipAllocationId, err)
+	}
+
+	return eipAllocationId, nil
+}
+
+// ReleaseReservedEip releases the EIP reserved for the pod but never associated with it.
+func (m *IPAddressManager) ReleaseReservedEip(
+	pod *corev1.Pod, eipAssociation *ekspodeipv1.EksPodEipAssociation) (string, error) {
+
+	if !podEipReserved(pod) {
+		return "", nil
+	}
+
+	store, err := m.storeOf(eipAssociation.Spec.EipPool)
+	if err != nil {
+		return "", err
+	}
+
+	// the reservation is claimed by the pod name first, it is released by the name then
+	if err := store.ClaimEIPAllocationId(pod.GetNamespace(), pod.GetName(), "",
+		podReservationToken(pod), eipAssociation.Spec.EipAllocationId); err != nil {
+		var heldErr *HeldError
+		if errors.As(err, &heldErr) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return m.ReleaseEip(eipAssociation)
+}
+
+// ReleaseEip releases the EIPs of the association by the release policy.
+func (m *IPAddressManager) ReleaseEip(eipAssociation *ekspodeipv1.EksPodEipAssociation) (string, error) {
+	if eipAssociation.Spec.EipPool == "" && !eipAssociation.Spec.ManagedEip {
+		return "", nil
+	}
+
+	store, err := m.storeOf(eipAssociation.Spec.EipPool)
+	if err != nil {
+		return "", err
+	}
+
+	if eipAssociation.Spec.ReleasePolicy == ekspodeipv1.EipReleasePolicyRetain {
+		// keep the records, the pod with the same name reuses the EIP
+		return "", m.RetainEip(eipAssociation, eipAssociation.Spec.StickyStatefulSet)
+	}
+
+	if eipAssociation.Spec.EipPool != "" {
+		defer m.notifyPool(eipAssociation.Spec.EipPool)
+	}
+
+	var released string
+	for idx, binding := range eipAssociation.Spec.Bindings() {
+		eipAllocationId, err := m.releaseBinding(store, eipAssociation, binding)
+		if err != nil {
+			return "", err
+		}
+		if idx == 0 {
+			released = eipAllocationId
+		}
+	}
+
+	return released, nil
+}
+
+func (m *IPAddressManager) releaseBinding(store IPAddressStore,
+	eipAssociation *ekspodeipv1.EksPodEipAssociation, binding ekspodeipv1.EipBinding) (string, error) {
+
+	if eipAssociation.Spec.ReleasePolicy == ekspodeipv1.EipReleasePolicyReturnToPool ||
+		eipAssociation.Spec.EipPool != "" {
+		// the pre-provisioned EIP can't be released back to aws
+		return store.ReleaseEIPAllocationId(
+			eipAssociation.Spec.PodNamespace, eipAssociation.Spec.PodName,
+			binding.PrivateIP, binding.EipAllocationId)
+	}
+
+	if err := m.deleteAwsEip(binding.EipAllocationId); err != nil {
+		return "", err
+	}
+
+	if err := store.RemoveEIPAllocationId(binding.EipAllocationId); err != nil {
+		return "", err
+	}
+
+	return binding.EipAllocationId, nil
+}
+
+// RetainEip keeps the EIPs of the association for the replacement pod with the same name.
+func (m *IPAddressManager) RetainEip(eipAssociation *ekspodeipv1.EksPodEipAssociation, statefulSet string) error {
+	if eipAssociation.Spec.EipPool == "" && !eipAssociation.Spec.ManagedEip {
+		return nil
+	}
+
+	store, err := m.storeOf(eipAssociation.Spec.EipPool)
+	if err != nil {
+		return err
+	}
+
+	releasePolicy := eipAssociation.Spec.ReleasePolicy
+	if releasePolicy == ekspodeipv1.EipReleasePolicyRetain || releasePolicy == "" {
+		releasePolicy = ekspodeipv1.EipReleasePolicyDelete
+	}
+
+	retention := Retention{
+		PodNamespace:  eipAssociation.Spec.PodNamespace,
+		PodName:       eipAssociation.Spec.PodName,
+		Since:         time.Now().UTC().Truncate(time.Second),
+		StatefulSet:   statefulSet,
+		ReleasePolicy: releasePolicy,
+	}
+
+	for _, binding := range eipAssociation.Spec.Bindings() {
+		if err := store.RetainEIPAllocationId(binding.EipAllocationId, retention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RetainedEip is an EIP kept for the replacement pod with the same name.
+type RetainedEip struct {
+	Retention
+	EipAllocationId string
+	EipPool         string
 }
 
-func (m *IPAddressManager) ReleaseEip(pod *corev1.Pod) (string, error) {
+// RetainedEips returns the EIPs kept for the replacement pods in the default store and the pools.
+func (m *IPAddressManager) RetainedEips() ([]RetainedEip, error) {
+	stores := map[string]IPAddressStore{"": m.store}
+
+	m.poolLock.Lock()
+	for pool, store := range m.poolStores {
+		stores[pool] = store
+	}
+	m.poolLock.Unlock()
+
+	var retainedEips []RetainedEip
+	for pool, store := range stores {
+		retained, err := store.GetRetainedEIPAllocationIds()
+		if err != nil {
+			return nil, err
+		}
+		for eipAllocationId, retention := range retained {
+			retainedEips = append(retainedEips, RetainedEip{
+				Retention:       retention,
+				EipAllocationId: eipAllocationId,
+				EipPool:         pool,
+			})
+		}
+	}
+
+	return retainedEips, nil
+}
+
+// ReleaseRetainedEip ends the retention of the EIP and releases it by the recorded policy.
+func (m *IPAddressManager) ReleaseRetainedEip(retainedEip RetainedEip) (bool, error) {
+	store, err := m.storeOf(retainedEip.EipPool)
+	if err != nil {
+		return false, err
+	}
+
+	// the record of the EIP released back to aws is removed first, no pod draws it in the meantime
+	remove := retainedEip.EipPool == "" && retainedEip.ReleasePolicy != ekspodeipv1.EipReleasePolicyReturnToPool
+
+	released, err := store.ReleaseRetainedEIPAllocationId(retainedEip.EipAllocationId, remove)
+	if err != nil || !released {
+		return false, err
+	}
+
+	if retainedEip.EipPool != "" {
+		m.notifyPool(retainedEip.EipPool)
+	}
+
+	if remove {
+		// the EIP failed to be released is orphaned and collected later
+		if err = m.deleteAwsEip(retainedEip.EipAllocationId); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// SyncPool updates the EIPs of the pool, and returns the numbers of free and used EIPs in the pool.
+func (m *IPAddressManager) SyncPool(pool string, eipAllocationIds []string) (int, int, error) {
+	store, err := m.poolStore(pool)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := store.SyncEIPAllocationIds(eipAllocationIds); err != nil {
+		return 0, 0, err
+	}
+
+	available, err := store.GetAvailableEIPAllocationIds()
+	if err != nil {
+		return 0, 0, err
+	}
+	associated, err := store.GetAllAssociatedEIPAllocationIds()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(available), len(associated), nil
+}
+
+// ClusterName returns the name of the cluster the EIPs allocated by the controller are tagged with.
+func (m *IPAddressManager) ClusterName() string {
+	return m.clusterName
+}
+
+// ListManagedEips returns the EIPs allocated by the controller in the cluster.
+func (m *IPAddressManager) ListManagedEips() ([]*ec2.Address, error) {
+	result, err := m.ec2Svc.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: m.ownerFilters(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Addresses, nil
+}
+
+// TrackedEipAllocationIds returns the EIPs recorded in the stores.
+func (m *IPAddressManager) TrackedEipAllocationIds() (map[string]bool, error) {
+	associated, err := m.store.GetAllAssociatedEIPAllocationIds()
+	if err != nil {
+		return nil, err
+	}
+	available, err := m.store.GetAvailableEIPAllocationIds()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(associated)+len(available))
+	for _, eipAllocationId := range append(associated, available...) {
+		tracked[eipAllocationId] = true
+	}
+
+	return tracked, nil
+}
+
+// ReleaseOrphanEip releases the EIP allocated by the controller but referenced by nothing back to aws.
+func (m *IPAddressManager) ReleaseOrphanEip(eipAllocationId string) error {
+	return m.deleteAwsEip(eipAllocationId)
+}
+
+func (m *IPAddressManager) allocatePoolEip(pod *corev1.Pod, pool string) (string, error) {
+	store, err := m.poolStore(pool)
+	if err != nil {
+		return "", err
+	}
+
+	// reuse the EIP drawn from the pool before
+	eipAllocationId, err := m.reuseEip(store, pod)
+	if err != nil {
+		return "", err
+	}
+	if eipAllocationId != "" {
+		return eipAllocationId, nil
+	}
+
+	eipAllocationId, err = m.drawEip(store, pod, PodIPv4(pod))
+	if err != nil {
+		return "", err
+	}
+	if eipAllocationId == "" {
+		return "", fmt.Errorf("no EIP available in pool %s", pool)
+	}
+
+	m.notifyPool(pool)
+
+	return eipAllocationId, nil
+}
+
+// claimEip associates the EIP reserved at the pod admission with the pod.
+func (m *IPAddressManager) claimEip(
+	pod *corev1.Pod, pool, associationName, eipAllocationId string) (string, bool, error) {
+
+	store, err := m.storeOf(pool)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := store.ClaimEIPAllocationId(pod.GetNamespace(), pod.GetName(), PodIPv4(pod),
+		podReservationToken(pod), eipAllocationId); err != nil {
+		return "", false, fmt.Errorf("unable to claim EIP %s reserved for the pod: %v", eipAllocationId, err)
+	}
+
+	if pool != "" {
+		return eipAllocationId, false, nil
+	}
+
+	// the pod name and the association are unknown at the reservation
+	if err := m.tagAwsEip(eipAllocationId, pod, associationName, internal.EipRolePrimary); err != nil {
+		return "", false, fmt.Errorf("unable to tag EIP %s: %v", eipAllocationId, err)
+	}
+
+	return eipAllocationId, true, nil
+}
+
+// drawEip associates an available EIP in the store with the private IP of the pod.
+func (m *IPAddressManager) drawEip(store IPAddressStore, pod *corev1.Pod, privateIP string) (string, error) {
+	available, err := store.GetAvailableEIPAllocationIds()
+	if err != nil {
+		return "", err
+	}
+
+	for _, eipAllocationId := range available {
+		// the EIP might be taken by others in the meantime, try the next one
+		if pod.GetName() == "" {
+			// the pod being admitted, the name is not generated yet
+			err = store.ReserveEIPAllocationId(pod.GetNamespace(), podReservationToken(pod), eipAllocationId)
+		} else {
+			_, err = store.AssociateEIPAllocationId(pod.GetNamespace(), pod.GetName(), privateIP, eipAllocationId)
+		}
+		if err == nil {
+			return eipAllocationId, nil
+		}
+	}
+
 	return "", nil
 }
 
-func (m *IPAddressManager) createAwsEip() (string, error) {
-	ec2Svc := ec2.New(m.awsSession)
+// reuseEip returns the EIP recorded for the pod in the store, and updates the pod IP recorded with it.
+func (m *IPAddressManager) reuseEip(store IPAddressStore, pod *corev1.Pod) (string, error) {
+	if pod.GetName() == "" {
+		// the name is not generated yet at the pod admission, don't take the reservations of other pods
+		return "", nil
+	}
+
+	eipAllocationId, err := store.GetAssociatedEIPAllocationId(pod.GetNamespace(), pod.GetName(), "", "")
+	if err != nil || eipAllocationId == "" {
+		return "", err
+	}
+
+	return store.AssociateEIPAllocationId(pod.GetNamespace(), pod.GetName(), PodIPv4(pod), eipAllocationId)
+}
+
+// storeOf returns the store of the pool, or the default store if the pool is empty.
+func (m *IPAddressManager) storeOf(pool string) (IPAddressStore, error) {
+	if pool == "" {
+		return m.store, nil
+	}
 
-	eipAllocation, err := ec2Svc.AllocateAddress(&ec2.AllocateAddressInput{
+	return m.poolStore(pool)
+}
+
+func (m *IPAddressManager) poolStore(pool string) (IPAddressStore, error) {
+	m.poolLock.Lock()
+	defer m.poolLock.Unlock()
+
+	store, exists := m.poolStores[pool]
+	if !exists {
+		var err error
+		if store, err = m.newStore(PoolStoreName(pool)); err != nil {
+			return nil, fmt.Errorf("unable to create the store of EipPool %s: %v", pool, err)
+		}
+		m.poolStores[pool] = store
+	}
+
+	return store, nil
+}
+
+// podEipReserved returns whether the EIP of the pod is reserved at the admission.
+func podEipReserved(pod *corev1.Pod) bool {
+	return pod.GetAnnotations()[internal.PodEipReservedAnnotation] == "true"
+}
+
+// podReservationToken returns the token the EIP is reserved for at the pod admission.
+func podReservationToken(pod *corev1.Pod) string {
+	return pod.GetAnnotations()[internal.PodEipReservationTokenAnnotation]
+}
+
+// notifyPool sends the event of the pool without blocking the allocation.
+func (m *IPAddressManager) notifyPool(pool string) {
+	select {
+	case m.poolEvents <- event.GenericEvent{Object: &ekspodeipv1.EipPool{ObjectMeta: metav1.ObjectMeta{Name: pool}}}:
+	default:
+	}
+}
+
+// eipTags returns the aws tags of the owner and the role of the EIP.
+func (m *IPAddressManager) eipTags(pod *corev1.Pod, associationName, role string) []*ec2.Tag {
+	return []*ec2.Tag{
+		{Key: aws.String(internal.EipManagedByTag), Value: aws.String(internal.EipManagedByTagValue)},
+		{Key: aws.String(internal.EipClusterNameTag), Value: aws.String(m.clusterName)},
+		{Key: aws.String(internal.EipVpcIdTag), Value: aws.String(m.vpcId)},
+		{Key: aws.String(internal.EipPodNamespaceTag), Value: aws.String(pod.GetNamespace())},
+		{Key: aws.String(internal.EipPodNameTag), Value: aws.String(pod.GetName())},
+		{Key: aws.String(internal.EipAssociationNameTag), Value: aws.String(associationName)},
+		{Key: aws.String(internal.EipRoleTag), Value: aws.String(role)},
+	}
+}
+
+// ownerFilters returns the aws filters matching the EIPs allocated by the controller in the cluster.
+func (m *IPAddressManager) ownerFilters() []*ec2.Filter {
+	return []*ec2.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", internal.EipManagedByTag)),
+			Values: []*string{aws.String(internal.EipManagedByTagValue)},
+		},
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", internal.EipClusterNameTag)),
+			Values: []*string{aws.String(m.clusterName)},
+		},
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", internal.EipVpcIdTag)),
+			Values: []*string{aws.String(m.vpcId)},
+		},
+	}
+}
+
+func (m *IPAddressManager) createAwsEip(pod *corev1.Pod, associationName, role string) (string, error) {
+	eipAllocation, err := m.ec2Svc.AllocateAddress(&ec2.AllocateAddressInput{
 		Domain: aws.String("vpc"),
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String(ec2.ResourceTypeElasticIp),
+				Tags:         m.eipTags(pod, associationName, role),
+			},
+		},
 	})
 	if err != nil {
 		return "", err
@@ -47,3 +692,59 @@ func (m *IPAddressManager) createAwsEip() (string, error) {
 
 	return *eipAllocation.AllocationId, nil
 }
+
+// findAwsEip returns the unassociated EIP tagged for the pod IP.
+func (m *IPAddressManager) findAwsEip(pod *corev1.Pod) (string, error) {
+	filters := append(m.ownerFilters(),
+		&ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", internal.EipPodNamespaceTag)),
+			Values: []*string{aws.String(pod.GetNamespace())},
+		},
+		&ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", internal.EipPodNameTag)),
+			Values: []*string{aws.String(pod.GetName())},
+		},
+		&ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", internal.EipRoleTag)),
+			Values: []*string{aws.String(internal.EipRolePrimary)},
+		})
+
+	result, err := m.ec2Svc.DescribeAddresses(&ec2.DescribeAddressesInput{
+		Filters: filters,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, address := range result.Addresses {
+		if address.AssociationId == nil || aws.StringValue(address.PrivateIpAddress) == PodIPv4(pod) {
+			return aws.StringValue(address.AllocationId), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (m *IPAddressManager) tagAwsEip(eipAllocationId string, pod *corev1.Pod, associationName, role string) error {
+	_, err := m.ec2Svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String(eipAllocationId)},
+		Tags:      m.eipTags(pod, associationName, role),
+	})
+
+	return err
+}
+
+func (m *IPAddressManager) deleteAwsEip(eipAllocationId string) error {
+	_, err := m.ec2Svc.ReleaseAddress(&ec2.ReleaseAddressInput{
+		AllocationId: aws.String(eipAllocationId),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidAllocationID.NotFound" {
+			// the EIP has been released already
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
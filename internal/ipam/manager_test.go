@@ -0,0 +1,438 @@
+package ipam
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ec2api"
+)
+
+const (
+	testVpcId       = "vpc-0123456789abcdef0"
+	testClusterName = "test-cluster"
+)
+
+func newTestPod(namespace, name, podIP string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Status:     corev1.PodStatus{PodIP: podIP},
+	}
+}
+
+var _ = Describe("IPAddressManager", func() {
+	var (
+		fakeEC2 *ec2api.FakeEC2
+		manager *IPAddressManager
+	)
+
+	BeforeEach(func() {
+		fakeEC2 = ec2api.NewFakeEC2()
+		c := fake.NewClientBuilder().Build()
+		var err error
+		manager, err = NewIPAddressManager(fakeEC2, testVpcId, testClusterName, func(name string) (IPAddressStore, error) {
+			return NewConfigMapIPAddressStore(c, testStoreNamespace, name)
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("refuses to be created without the cluster name", func() {
+		_, err := NewIPAddressManager(fakeEC2, testVpcId, "", func(name string) (IPAddressStore, error) {
+			return nil, nil
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("refuses to be created without the store", func() {
+		_, err := NewIPAddressManager(fakeEC2, testVpcId, testClusterName, func(name string) (IPAddressStore, error) {
+			return NewConfigMapIPAddressStore(nil, testStoreNamespace, name)
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("drawing EIPs from a pool", func() {
+		BeforeEach(func() {
+			_, _, err := manager.SyncPool("edge", []string{"eipalloc-1"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("notifies the pool on the allocation and the release", func() {
+			pod := newTestPod("ns", "pod-0", "10.0.0.1")
+
+			eipAllocationId, managed, err := manager.AllocateEip(pod, "edge", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eipAllocationId).To(Equal("eipalloc-1"))
+			Expect(managed).To(BeFalse())
+			Expect(manager.PoolEvents()).To(Receive(WithTransform(func(e event.GenericEvent) string {
+				return e.Object.GetName()
+			}, Equal("edge"))))
+
+			_, err = manager.ReleaseEip(&ekspodeipv1.EksPodEipAssociation{
+				Spec: ekspodeipv1.EksPodEipAssociationSpec{
+					PodNamespace:    "ns",
+					PodName:         "pod-0",
+					PrivateIP:       "10.0.0.1",
+					EipAllocationId: eipAllocationId,
+					EipPool:         "edge",
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manager.PoolEvents()).To(Receive())
+
+			free, used, err := manager.SyncPool("edge", []string{"eipalloc-1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(free).To(Equal(1))
+			Expect(used).To(BeZero())
+		})
+	})
+
+	Context("retaining EIPs", func() {
+		var eipAssociation *ekspodeipv1.EksPodEipAssociation
+
+		BeforeEach(func() {
+			pod := newTestPod("ns", "web-1", "10.0.0.1")
+
+			eipAllocationId, managed, err := manager.AllocateEip(pod, "", "ns.web-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(managed).To(BeTrue())
+
+			eipAssociation = &ekspodeipv1.EksPodEipAssociation{
+				Spec: ekspodeipv1.EksPodEipAssociationSpec{
+					PodNamespace:      "ns",
+					PodName:           "web-1",
+					PrivateIP:         "10.0.0.1",
+					EipAllocationId:   eipAllocationId,
+					ManagedEip:        true,
+					StickyStatefulSet: "web",
+				},
+			}
+			Expect(manager.RetainEip(eipAssociation, "web")).To(Succeed())
+		})
+
+		It("reports the EIP retained and keeps it tracked", func() {
+			retainedEips, err := manager.RetainedEips()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retainedEips).To(HaveLen(1))
+			Expect(retainedEips[0].EipAllocationId).To(Equal(eipAssociation.Spec.EipAllocationId))
+			Expect(retainedEips[0].StatefulSet).To(Equal("web"))
+			Expect(retainedEips[0].ReleasePolicy).To(Equal(ekspodeipv1.EipReleasePolicyDelete))
+
+			tracked, err := manager.TrackedEipAllocationIds()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tracked).To(HaveKey(eipAssociation.Spec.EipAllocationId))
+		})
+
+		It("ends the retention once the replacement pod reuses the EIP", func() {
+			eipAllocationId, _, err := manager.AllocateEip(newTestPod("ns", "web-1", "10.0.0.2"), "", "ns.web-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eipAllocationId).To(Equal(eipAssociation.Spec.EipAllocationId))
+
+			Expect(manager.RetainedEips()).To(BeEmpty())
+
+			released, err := manager.ReleaseRetainedEip(RetainedEip{
+				EipAllocationId: eipAllocationId,
+				Retention:       Retention{ReleasePolicy: ekspodeipv1.EipReleasePolicyDelete},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(released).To(BeFalse())
+			Expect(fakeEC2.Addresses()).To(HaveLen(1))
+		})
+
+		It("releases the EIP back to aws and stops tracking it after the retention ends", func() {
+			retainedEips, err := manager.RetainedEips()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retainedEips).To(HaveLen(1))
+
+			Expect(manager.ReleaseRetainedEip(retainedEips[0])).To(BeTrue())
+
+			Expect(fakeEC2.Addresses()).To(BeEmpty())
+			Expect(manager.TrackedEipAllocationIds()).To(BeEmpty())
+		})
+
+		It("returns the EIP to the pool by the release policy after the retention ends", func() {
+			retainedEips, err := manager.RetainedEips()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retainedEips).To(HaveLen(1))
+
+			retainedEips[0].ReleasePolicy = ekspodeipv1.EipReleasePolicyReturnToPool
+			Expect(manager.ReleaseRetainedEip(retainedEips[0])).To(BeTrue())
+
+			Expect(fakeEC2.Addresses()).To(HaveLen(1))
+			eipAllocationId, _, err := manager.AllocateEip(newTestPod("ns", "other", "10.0.0.3"), "", "ns.other")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eipAllocationId).To(Equal(eipAssociation.Spec.EipAllocationId))
+		})
+	})
+
+	Context("releasing EIPs by the Retain policy", func() {
+		It("retains the EIP for the pod owned by no StatefulSet until it expires", func() {
+			pod := newTestPod("ns", "pod-0", "10.0.0.1")
+
+			eipAllocationId, _, err := manager.AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manager.ReleaseEip(&ekspodeipv1.EksPodEipAssociation{
+				Spec: ekspodeipv1.EksPodEipAssociationSpec{
+					PodNamespace:    "ns",
+					PodName:         "pod-0",
+					PrivateIP:       "10.0.0.1",
+					EipAllocationId: eipAllocationId,
+					ManagedEip:      true,
+					ReleasePolicy:   ekspodeipv1.EipReleasePolicyRetain,
+				},
+			})).To(BeEmpty())
+
+			retainedEips, err := manager.RetainedEips()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retainedEips).To(HaveLen(1))
+			Expect(retainedEips[0].EipAllocationId).To(Equal(eipAllocationId))
+			Expect(retainedEips[0].StatefulSet).To(BeEmpty())
+			Expect(retainedEips[0].ReleasePolicy).To(Equal(ekspodeipv1.EipReleasePolicyDelete))
+			Expect(retainedEips[0].Since).NotTo(BeZero())
+		})
+
+		It("retains the reservation never claimed for the pod", func() {
+			pod := newTestPod("ns", "", "")
+			pod.Annotations = map[string]string{
+				internal.PodEipReservationTokenAnnotation: "token-a",
+				internal.PodEipReservedAnnotation:         "true",
+			}
+
+			_, _, err := manager.SyncPool("edge", []string{"eipalloc-1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manager.ReserveEip(pod, "edge")).To(Equal("eipalloc-1"))
+
+			eipAssociation := &ekspodeipv1.EksPodEipAssociation{
+				Spec: ekspodeipv1.EksPodEipAssociationSpec{
+					PodNamespace:    "ns",
+					PodName:         "pod-0",
+					EipAllocationId: "eipalloc-1",
+					EipPool:         "edge",
+					ReleasePolicy:   ekspodeipv1.EipReleasePolicyRetain,
+				},
+			}
+
+			// another pod in the namespace can't release the reservation
+			other := newTestPod("ns", "pod-1", "")
+			other.Annotations = map[string]string{
+				internal.PodEipReservationTokenAnnotation: "token-b",
+				internal.PodEipReservedAnnotation:         "true",
+			}
+			eipAssociation.Spec.PodName = "pod-1"
+			Expect(manager.ReleaseReservedEip(other, eipAssociation)).To(BeEmpty())
+			Expect(manager.RetainedEips()).To(BeEmpty())
+
+			pod.Name = "pod-0"
+			eipAssociation.Spec.PodName = "pod-0"
+			Expect(manager.ReleaseReservedEip(pod, eipAssociation)).To(BeEmpty())
+
+			retainedEips, err := manager.RetainedEips()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retainedEips).To(HaveLen(1))
+			Expect(retainedEips[0].PodName).To(Equal("pod-0"))
+			Expect(retainedEips[0].EipPool).To(Equal("edge"))
+		})
+	})
+
+	Context("allocating EIPs for the secondary private IPs", func() {
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			pod = newTestPod("ns", "pod-0", "10.0.0.1")
+		})
+
+		It("allocates an EIP per secondary private IP and reuses the one recorded", func() {
+			eipAllocationId, _, err := manager.AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+
+			first, err := manager.AllocateSecondaryEip(pod, "", "ns.pod-0", "10.0.1.1")
+			Expect(err).NotTo(HaveOccurred())
+			second, err := manager.AllocateSecondaryEip(pod, "", "ns.pod-0", "10.0.1.2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]string{eipAllocationId, first, second}).To(HaveEach(HavePrefix("eipalloc-")))
+			Expect(first).NotTo(Equal(eipAllocationId))
+			Expect(second).NotTo(Equal(first))
+			Expect(fakeEC2.Addresses()).To(HaveLen(3))
+
+			// e.g. the association failed to be created after the allocation
+			Expect(manager.AllocateSecondaryEip(pod, "", "ns.pod-0", "10.0.1.1")).To(Equal(first))
+			Expect(fakeEC2.Addresses()).To(HaveLen(3))
+
+			tracked, err := manager.TrackedEipAllocationIds()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tracked).To(HaveKey(first))
+			Expect(tracked).To(HaveKey(second))
+		})
+
+		It("draws the EIP from the pool and fails once the pool is exhausted", func() {
+			_, _, err := manager.SyncPool("edge", []string{"eipalloc-1", "eipalloc-2"})
+			Expect(err).NotTo(HaveOccurred())
+
+			eipAllocationId, _, err := manager.AllocateEip(pod, "edge", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manager.PoolEvents()).To(Receive())
+
+			secondaryEipAllocationId, err := manager.AllocateSecondaryEip(pod, "edge", "ns.pod-0", "10.0.1.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect([]string{eipAllocationId, secondaryEipAllocationId}).To(
+				ConsistOf("eipalloc-1", "eipalloc-2"))
+			Expect(manager.PoolEvents()).To(Receive())
+
+			_, err = manager.AllocateSecondaryEip(pod, "edge", "ns.pod-0", "10.0.1.2")
+			Expect(err).To(HaveOccurred())
+			Expect(fakeEC2.Addresses()).To(BeEmpty())
+
+			free, used, err := manager.SyncPool("edge", []string{"eipalloc-1", "eipalloc-2"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(free).To(BeZero())
+			Expect(used).To(Equal(2))
+		})
+	})
+
+	Context("releasing EIPs by the release policy", func() {
+		var pod *corev1.Pod
+		var eipAssociation *ekspodeipv1.EksPodEipAssociation
+
+		addressIds := func() []string {
+			var eipAllocationIds []string
+			for _, address := range fakeEC2.Addresses() {
+				eipAllocationIds = append(eipAllocationIds, aws.StringValue(address.AllocationId))
+			}
+			return eipAllocationIds
+		}
+
+		BeforeEach(func() {
+			pod = newTestPod("ns", "pod-0", "10.0.0.1")
+
+			eipAllocationId, managed, err := manager.AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(managed).To(BeTrue())
+			secondaryEipAllocationId, err := manager.AllocateSecondaryEip(pod, "", "ns.pod-0", "10.0.1.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			eipAssociation = &ekspodeipv1.EksPodEipAssociation{
+				Spec: ekspodeipv1.EksPodEipAssociationSpec{
+					PodNamespace:    "ns",
+					PodName:         "pod-0",
+					PrivateIP:       "10.0.0.1",
+					EipAllocationId: eipAllocationId,
+					ManagedEip:      true,
+					SecondaryBindings: []ekspodeipv1.EipBinding{
+						{PrivateIP: "10.0.1.1", EipAllocationId: secondaryEipAllocationId},
+					},
+				},
+			}
+		})
+
+		It("releases the EIPs back to aws by the Delete policy", func() {
+			eipAssociation.Spec.ReleasePolicy = ekspodeipv1.EipReleasePolicyDelete
+
+			Expect(manager.ReleaseEip(eipAssociation)).To(Equal(eipAssociation.Spec.EipAllocationId))
+
+			Expect(fakeEC2.Addresses()).To(BeEmpty())
+			Expect(manager.TrackedEipAllocationIds()).To(BeEmpty())
+		})
+
+		It("releases the EIPs back to aws without the policy", func() {
+			Expect(manager.ReleaseEip(eipAssociation)).To(Equal(eipAssociation.Spec.EipAllocationId))
+
+			Expect(fakeEC2.Addresses()).To(BeEmpty())
+		})
+
+		It("keeps the EIPs for other pods by the ReturnToPool policy", func() {
+			eipAssociation.Spec.ReleasePolicy = ekspodeipv1.EipReleasePolicyReturnToPool
+
+			Expect(manager.ReleaseEip(eipAssociation)).To(Equal(eipAssociation.Spec.EipAllocationId))
+			Expect(addressIds()).To(ConsistOf(eipAssociation.Spec.EipAllocationId,
+				eipAssociation.Spec.SecondaryBindings[0].EipAllocationId))
+			Expect(manager.RetainedEips()).To(BeEmpty())
+
+			// the EIP returned is drawn by another pod rather than allocated from aws
+			eipAllocationId, managed, err := manager.AllocateEip(newTestPod("ns", "pod-1", "10.0.0.2"), "", "ns.pod-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(managed).To(BeTrue())
+			Expect(eipAllocationId).To(BeElementOf(addressIds()))
+			Expect(fakeEC2.Addresses()).To(HaveLen(2))
+		})
+
+		It("keeps the EIPs for the pod with the same name by the Retain policy", func() {
+			eipAssociation.Spec.ReleasePolicy = ekspodeipv1.EipReleasePolicyRetain
+
+			Expect(manager.ReleaseEip(eipAssociation)).To(BeEmpty())
+			Expect(fakeEC2.Addresses()).To(HaveLen(2))
+
+			retainedEips, err := manager.RetainedEips()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retainedEips).To(HaveLen(2))
+
+			// the replacement pod reuses the EIP of the pod IP
+			eipAllocationId, _, err := manager.AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eipAllocationId).To(Equal(eipAssociation.Spec.EipAllocationId))
+		})
+
+		It("never releases the EIP specified by the user", func() {
+			eipAssociation.Spec.ManagedEip = false
+			eipAssociation.Spec.ReleasePolicy = ekspodeipv1.EipReleasePolicyDelete
+
+			Expect(manager.ReleaseEip(eipAssociation)).To(BeEmpty())
+			Expect(fakeEC2.Addresses()).To(HaveLen(2))
+		})
+	})
+
+	Context("adopting the EIPs tagged for the pod", func() {
+		// the manager restarted with the records lost, only the tags of the EIPs are left
+		restarted := func() *IPAddressManager {
+			c := fake.NewClientBuilder().Build()
+			restarted, err := NewIPAddressManager(fakeEC2, testVpcId, testClusterName,
+				func(name string) (IPAddressStore, error) {
+					return NewConfigMapIPAddressStore(c, testStoreNamespace, name)
+				})
+			Expect(err).NotTo(HaveOccurred())
+			return restarted
+		}
+
+		It("adopts the EIP of the pod IP", func() {
+			pod := newTestPod("ns", "pod-0", "10.0.0.1")
+
+			eipAllocationId, _, err := manager.AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+
+			adopted, managed, err := restarted().AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(managed).To(BeTrue())
+			Expect(adopted).To(Equal(eipAllocationId))
+		})
+
+		It("never adopts the EIP of a secondary private IP as the EIP of the pod IP", func() {
+			pod := newTestPod("ns", "pod-0", "10.0.0.1")
+
+			secondaryEipAllocationId, err := manager.AllocateSecondaryEip(pod, "", "ns.pod-0", "10.0.1.1")
+			Expect(err).NotTo(HaveOccurred())
+
+			eipAllocationId, managed, err := restarted().AllocateEip(pod, "", "ns.pod-0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(managed).To(BeTrue())
+			Expect(eipAllocationId).NotTo(Equal(secondaryEipAllocationId))
+
+			roles := map[string]string{}
+			for _, address := range fakeEC2.Addresses() {
+				for _, tag := range address.Tags {
+					if aws.StringValue(tag.Key) == internal.EipRoleTag {
+						roles[aws.StringValue(address.AllocationId)] = aws.StringValue(tag.Value)
+					}
+				}
+			}
+			Expect(roles).To(Equal(map[string]string{
+				eipAllocationId:          internal.EipRolePrimary,
+				secondaryEipAllocationId: internal.EipRoleSecondary,
+			}))
+		})
+	})
+})
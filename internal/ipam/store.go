@@ -1,10 +1,47 @@
 package ipam
 
+import (
+	"fmt"
+	"time"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
 type IPAddressStore interface {
 	AssociateEIPAllocationId(podNamespace, podName, podIP, eipAllocationId string) (string, error)
 	ReleaseEIPAllocationId(podNamespace, podName, podIP, eipAllocationId string) (string, error)
+	RemoveEIPAllocationId(eipAllocationId string) error
+	SyncEIPAllocationIds(eipAllocationIds []string) error
+
+	ReserveEIPAllocationId(podNamespace, token, eipAllocationId string) error
+	ClaimEIPAllocationId(podNamespace, podName, podIP, token, eipAllocationId string) error
+
+	RetainEIPAllocationId(eipAllocationId string, retention Retention) error
+	ReleaseRetainedEIPAllocationId(eipAllocationId string, remove bool) (bool, error)
 
 	GetAssociatedEIPAllocationId(podNamespace, podName, podIP, eipAllocationId string) (string, error)
 	GetAllAssociatedEIPAllocationIds() ([]string, error)
 	GetAvailableEIPAllocationIds() ([]string, error)
+	GetRetainedEIPAllocationIds() (map[string]Retention, error)
+}
+
+// Retention describes the EIP kept for the pod with the same name.
+type Retention struct {
+	PodNamespace string
+	PodName      string
+	Since        time.Time
+	// StatefulSet is the StatefulSet the EIP is sticky to the pod ordinal of.
+	StatefulSet string
+	// ReleasePolicy is applied to the EIP allocated by the controller after the retention ends.
+	ReleasePolicy ekspodeipv1.EipReleasePolicy
+}
+
+// HeldError is returned when the EIP is associated with or reserved for another pod.
+type HeldError struct {
+	EipAllocationId string
+	Reason          string
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("EIP %s is %s", e.EipAllocationId, e.Reason)
 }
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+const (
+	collectTimeout = time.Second * 10
+)
+
+var _ prometheus.Collector = &stateCollector{}
+
+// stateCollector reports the gauges of the associations and the pools at the scrape.
+type stateCollector struct {
+	client client.Reader
+
+	associatedPods *prometheus.Desc
+	poolFree       *prometheus.Desc
+	poolUsed       *prometheus.Desc
+}
+
+// RegisterStateCollector registers the collector of the gauges read from the cache by the client.
+func RegisterStateCollector(c client.Reader) error {
+	return metrics.Registry.Register(newStateCollector(c))
+}
+
+func newStateCollector(c client.Reader) *stateCollector {
+	return &stateCollector{
+		client: c,
+		associatedPods: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "associated_pods"),
+			"Number of the pods associated with the EIP, by the namespace of the pod.",
+			[]string{"namespace"}, nil),
+		poolFree: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "pool_free_eips"),
+			"Number of the free EIPs in the EipPool.",
+			[]string{"pool"}, nil),
+		poolUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "pool_used_eips"),
+			"Number of the EIPs drawn from the EipPool by the pods.",
+			[]string{"pool"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.associatedPods
+	ch <- c.poolFree
+	ch <- c.poolUsed
+}
+
+// Collect implements prometheus.Collector.
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	logger := log.FromContext(ctx).WithName("metrics")
+
+	var eipAssociations ekspodeipv1.EksPodEipAssociationList
+	if err := c.client.List(ctx, &eipAssociations); err != nil {
+		logger.V(1).Error(err, "unable to list EksPodEipAssociations")
+	} else {
+		associatedPods := make(map[string]int)
+		for _, eipAssociation := range eipAssociations.Items {
+			if eipAssociation.Status.Associated {
+				associatedPods[eipAssociation.Spec.PodNamespace]++
+			}
+		}
+		for ns, count := range associatedPods {
+			ch <- prometheus.MustNewConstMetric(c.associatedPods, prometheus.GaugeValue, float64(count), ns)
+		}
+	}
+
+	var eipPools ekspodeipv1.EipPoolList
+	if err := c.client.List(ctx, &eipPools); err != nil {
+		logger.V(1).Error(err, "unable to list EipPools")
+	} else {
+		for _, eipPool := range eipPools.Items {
+			ch <- prometheus.MustNewConstMetric(c.poolFree, prometheus.GaugeValue,
+				float64(eipPool.Status.Free), eipPool.Name)
+			ch <- prometheus.MustNewConstMetric(c.poolUsed, prometheus.GaugeValue,
+				float64(eipPool.Status.Used), eipPool.Name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+var _ = Describe("stateCollector", func() {
+	newAssociation := func(namespace, name string, associated bool) *ekspodeipv1.EksPodEipAssociation {
+		return &ekspodeipv1.EksPodEipAssociation{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "eks-pod-eip", Name: name},
+			Spec:       ekspodeipv1.EksPodEipAssociationSpec{PodNamespace: namespace, PodName: name},
+			Status:     ekspodeipv1.EksPodEipAssociationStatus{Associated: associated},
+		}
+	}
+
+	It("reports the associated pods by the namespace and the EIPs of the pools", func() {
+		testScheme := runtime.NewScheme()
+		Expect(ekspodeipv1.AddToScheme(testScheme)).To(Succeed())
+
+		c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(
+			newAssociation("ns-a", "pod-0", true),
+			newAssociation("ns-a", "pod-1", true),
+			newAssociation("ns-b", "pod-2", true),
+			newAssociation("ns-b", "pod-3", false),
+			&ekspodeipv1.EipPool{
+				ObjectMeta: metav1.ObjectMeta{Name: "edge"},
+				Status:     ekspodeipv1.EipPoolStatus{Total: 5, Free: 3, Used: 2},
+			},
+		).Build()
+
+		expected := `
+# HELP eks_pod_eip_associated_pods Number of the pods associated with the EIP, by the namespace of the pod.
+# TYPE eks_pod_eip_associated_pods gauge
+eks_pod_eip_associated_pods{namespace="ns-a"} 2
+eks_pod_eip_associated_pods{namespace="ns-b"} 1
+# HELP eks_pod_eip_pool_free_eips Number of the free EIPs in the EipPool.
+# TYPE eks_pod_eip_pool_free_eips gauge
+eks_pod_eip_pool_free_eips{pool="edge"} 3
+# HELP eks_pod_eip_pool_used_eips Number of the EIPs drawn from the EipPool by the pods.
+# TYPE eks_pod_eip_pool_used_eips gauge
+eks_pod_eip_pool_used_eips{pool="edge"} 2
+`
+		Expect(testutil.CollectAndCompare(newStateCollector(c), strings.NewReader(expected))).To(Succeed())
+	})
+
+	It("reports nothing without the resources", func() {
+		testScheme := runtime.NewScheme()
+		Expect(ekspodeipv1.AddToScheme(testScheme)).To(Succeed())
+
+		c := fake.NewClientBuilder().WithScheme(testScheme).Build()
+
+		Expect(testutil.CollectAndCount(newStateCollector(c))).To(BeZero())
+	})
+})
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "eks_pod_eip"
+
+	ResultSuccess = "success"
+	ResultError   = "error"
+
+	SourcePool       = "pool"
+	SourceController = "controller"
+	SourceUser       = "user"
+)
+
+var (
+	eipAllocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "allocations_total",
+		Help:      "Number of the EIP allocations for the pods, by the source of the EIP and the result.",
+	}, []string{"source", "result"})
+
+	eipAssociations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "associations_total",
+		Help:      "Number of the EIP associations with the private IPs of the pods, by the result.",
+	}, []string{"result"})
+
+	eipReleases = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "releases_total",
+		Help:      "Number of the EIPs released from the pods, by the release policy.",
+	}, []string{"policy"})
+
+	eipAssociationLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "association_latency_seconds",
+		Help:      "Time from the pod IP is allocated to the EIP is associated with it.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	})
+
+	ec2RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ec2_request_duration_seconds",
+		Help:      "Latency of the aws EC2 API requests, by the operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	ec2RequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ec2_request_errors_total",
+		Help:      "Number of the failed aws EC2 API requests, by the operation and the aws error code.",
+	}, []string{"operation", "code"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		eipAllocations,
+		eipAssociations,
+		eipReleases,
+		eipAssociationLatency,
+		ec2RequestDuration,
+		ec2RequestErrors,
+	)
+}
+
+// RecordEipAllocation counts the EIP allocation for the pod.
+func RecordEipAllocation(source string, err error) {
+	eipAllocations.WithLabelValues(source, result(err)).Inc()
+}
+
+// RecordEipAssociation counts the EIP association with the private IP of the pod.
+func RecordEipAssociation(err error) {
+	eipAssociations.WithLabelValues(result(err)).Inc()
+}
+
+// RecordEipRelease counts the EIP released from the pod by the policy.
+func RecordEipRelease(policy string) {
+	eipReleases.WithLabelValues(policy).Inc()
+}
+
+// ObserveEipAssociationLatency records the time from the pod IP is allocated to the EIP is associated.
+func ObserveEipAssociationLatency(latency time.Duration) {
+	eipAssociationLatency.Observe(latency.Seconds())
+}
+
+// ObserveEC2Request records the latency and the error of the aws EC2 API request.
+func ObserveEC2Request(operation string, latency time.Duration, err error) {
+	ec2RequestDuration.WithLabelValues(operation).Observe(latency.Seconds())
+
+	if err != nil {
+		code := "Unknown"
+		if aerr, ok := err.(awserr.Error); ok {
+			code = aerr.Code()
+		}
+		ec2RequestErrors.WithLabelValues(operation, code).Inc()
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
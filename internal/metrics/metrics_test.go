@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("ObserveEC2Request", func() {
+	BeforeEach(func() {
+		ec2RequestDuration.Reset()
+		ec2RequestErrors.Reset()
+	})
+
+	It("labels the failed request by the aws error code", func() {
+		ObserveEC2Request("ReleaseAddress", time.Millisecond,
+			awserr.New("InvalidAllocationID.NotFound", "the allocation ID does not exist", nil))
+		ObserveEC2Request("ReleaseAddress", time.Millisecond, errors.New("connection reset"))
+		ObserveEC2Request("ReleaseAddress", time.Millisecond, nil)
+
+		Expect(testutil.ToFloat64(
+			ec2RequestErrors.WithLabelValues("ReleaseAddress", "InvalidAllocationID.NotFound"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(ec2RequestErrors.WithLabelValues("ReleaseAddress", "Unknown"))).To(Equal(1.0))
+		Expect(testutil.CollectAndCount(ec2RequestErrors)).To(Equal(2))
+		Expect(testutil.CollectAndCount(ec2RequestDuration)).To(Equal(1))
+	})
+})
+
+var _ = Describe("RecordEipAllocation", func() {
+	BeforeEach(func() {
+		eipAllocations.Reset()
+	})
+
+	It("labels the allocation by the source and the result", func() {
+		RecordEipAllocation(SourcePool, nil)
+		RecordEipAllocation(SourcePool, errors.New("no EIP available"))
+		RecordEipAllocation(SourceController, nil)
+
+		Expect(testutil.ToFloat64(eipAllocations.WithLabelValues(SourcePool, ResultSuccess))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(eipAllocations.WithLabelValues(SourcePool, ResultError))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(eipAllocations.WithLabelValues(SourceController, ResultSuccess))).To(Equal(1.0))
+	})
+})
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"path"
+)
+
+// DefaultExcludedNamespaces are the namespaces the EIP is never allocated to the pods in.
+var DefaultExcludedNamespaces = []string{"kube-system"}
+
+// NamespaceExcluded checks if the namespace matches any of the glob patterns.
+func NamespaceExcluded(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, namespace); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateNamespacePatterns checks the syntax of the glob patterns of the namespaces.
+func ValidateNamespacePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
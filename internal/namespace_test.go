@@ -0,0 +1,37 @@
+package internal
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NamespaceExcluded", func() {
+	DescribeTable("matching the namespace by the glob patterns",
+		func(patterns []string, namespace string, expected bool) {
+			Expect(NamespaceExcluded(patterns, namespace)).To(Equal(expected))
+		},
+		Entry("no pattern", nil, "kube-system", false),
+		Entry("the exact name", []string{"kube-system"}, "kube-system", true),
+		Entry("another name", []string{"kube-system"}, "default", false),
+		Entry("the prefix wildcard", []string{"kube-*"}, "kube-public", true),
+		Entry("the prefix wildcard not matching", []string{"kube-*"}, "app-kube", false),
+		Entry("the single character wildcard", []string{"team-?"}, "team-a", true),
+		Entry("the single character wildcard not matching", []string{"team-?"}, "team-ab", false),
+		Entry("the character class", []string{"team-[ab]"}, "team-b", true),
+		Entry("any of the patterns", []string{"default", "monitoring-*"}, "monitoring-prod", true),
+		Entry("the invalid pattern", []string{"team-["}, "team-[", false),
+	)
+
+	DescribeTable("validating the glob patterns",
+		func(patterns []string, valid bool) {
+			if valid {
+				Expect(ValidateNamespacePatterns(patterns)).To(Succeed())
+			} else {
+				Expect(ValidateNamespacePatterns(patterns)).NotTo(Succeed())
+			}
+		},
+		Entry("the default", DefaultExcludedNamespaces, true),
+		Entry("the wildcards", []string{"kube-*", "team-?", "team-[ab]"}, true),
+		Entry("the unclosed character class", []string{"kube-*", "team-["}, false),
+	)
+})
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+// PodEipPolicy returns the EipPolicy selecting the pod, nil if none selects it.
+func PodEipPolicy(ctx context.Context, c client.Reader,
+	pod *corev1.Pod, ns *corev1.Namespace) (*ekspodeipv1.EipPolicy, error) {
+
+	var policies ekspodeipv1.EipPolicyList
+	if err := c.List(ctx, &policies); err != nil {
+		return nil, fmt.Errorf("unable to list EipPolicies: %v", err)
+	}
+
+	return MatchingEipPolicy(policies.Items, pod, ns), nil
+}
+
+// MatchingEipPolicy returns the first EipPolicy by name selecting the pod.
+func MatchingEipPolicy(policies []ekspodeipv1.EipPolicy, pod *corev1.Pod, ns *corev1.Namespace) *ekspodeipv1.EipPolicy {
+	sorted := make([]*ekspodeipv1.EipPolicy, 0, len(policies))
+	for idx := range policies {
+		sorted = append(sorted, &policies[idx])
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	for _, policy := range sorted {
+		if !policy.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if EipPolicySelects(policy, pod, ns) {
+			return policy
+		}
+	}
+
+	return nil
+}
+
+// EipPolicySelects checks if the pod and its namespace are selected by the EipPolicy.
+func EipPolicySelects(policy *ekspodeipv1.EipPolicy, pod *corev1.Pod, ns *corev1.Namespace) bool {
+	return selectorMatches(policy.Spec.NamespaceSelector, ns.GetLabels()) &&
+		selectorMatches(policy.Spec.PodSelector, pod.GetLabels())
+}
+
+func selectorMatches(labelSelector *metav1.LabelSelector, set map[string]string) bool {
+	if labelSelector == nil {
+		return true
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false
+	}
+
+	return selector.Matches(labels.Set(set))
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+var _ admission.CustomValidator = &AssociationValidator{}
+
+// AssociationValidator validates the EksPodEipAssociation.
+type AssociationValidator struct{}
+
+//+kubebuilder:webhook:path=/validate-ekspodeip-rp-amazonaws-com-v1-ekspodeipassociation,mutating=false,failurePolicy=fail,sideEffects=None,groups=ekspodeip.rp.amazonaws.com,resources=ekspodeipassociations,verbs=create;update,versions=v1,name=vekspodeipassociation.ekspodeip.rp.amazonaws.com,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the webhook to the webhook server of the Manager.
+func (v *AssociationValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&ekspodeipv1.EksPodEipAssociation{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *AssociationValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	eipAssociation, ok := obj.(*ekspodeipv1.EksPodEipAssociation)
+	if !ok {
+		return fmt.Errorf("expected an EksPodEipAssociation but got a %T", obj)
+	}
+
+	return invalidAssociation(eipAssociation, validateAssociationSpec(&eipAssociation.Spec))
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *AssociationValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldEipAssociation, ok := oldObj.(*ekspodeipv1.EksPodEipAssociation)
+	if !ok {
+		return fmt.Errorf("expected an EksPodEipAssociation but got a %T", oldObj)
+	}
+	eipAssociation, ok := newObj.(*ekspodeipv1.EksPodEipAssociation)
+	if !ok {
+		return fmt.Errorf("expected an EksPodEipAssociation but got a %T", newObj)
+	}
+
+	allErrs := validateAssociationSpec(&eipAssociation.Spec)
+
+	if oldEipAssociation.Status.AssociationId != "" {
+		allErrs = append(allErrs, validateAssociationSpecUpdate(&eipAssociation.Spec, &oldEipAssociation.Spec)...)
+	}
+
+	return invalidAssociation(eipAssociation, allErrs)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *AssociationValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func validateAssociationSpec(spec *ekspodeipv1.EksPodEipAssociationSpec) field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if spec.PodNamespace == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("podNamespace"), ""))
+	}
+	if spec.PodName == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("podName"), ""))
+	}
+
+	if spec.PrivateIP == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("privateIP"), ""))
+	} else if ip := net.ParseIP(spec.PrivateIP); ip == nil || ip.To4() == nil {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("privateIP"), spec.PrivateIP,
+			"must be a valid IPv4 address"))
+	}
+
+	if msg := validateEipAllocationId(spec.EipAllocationId); msg != "" {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("eipAllocationId"), spec.EipAllocationId, msg))
+	}
+
+	privateIPs := []string{spec.PrivateIP}
+	eipAllocationIds := []string{spec.EipAllocationId}
+
+	for idx, binding := range spec.SecondaryBindings {
+		bindingPath := specPath.Child("secondaryBindings").Index(idx)
+
+		if ip := net.ParseIP(binding.PrivateIP); ip == nil || ip.To4() == nil {
+			allErrs = append(allErrs, field.Invalid(bindingPath.Child("privateIP"), binding.PrivateIP,
+				"must be a valid IPv4 address"))
+		} else if containsString(privateIPs, binding.PrivateIP) {
+			allErrs = append(allErrs, field.Duplicate(bindingPath.Child("privateIP"), binding.PrivateIP))
+		}
+
+		if msg := validateEipAllocationId(binding.EipAllocationId); msg != "" {
+			allErrs = append(allErrs, field.Invalid(bindingPath.Child("eipAllocationId"), binding.EipAllocationId, msg))
+		} else if containsString(eipAllocationIds, binding.EipAllocationId) {
+			allErrs = append(allErrs, field.Duplicate(bindingPath.Child("eipAllocationId"), binding.EipAllocationId))
+		}
+
+		privateIPs = append(privateIPs, binding.PrivateIP)
+		eipAllocationIds = append(eipAllocationIds, binding.EipAllocationId)
+	}
+
+	return allErrs
+}
+
+// validateAssociationSpecUpdate rejects the change of the EIPs and the pod of the association.
+func validateAssociationSpecUpdate(spec, oldSpec *ekspodeipv1.EksPodEipAssociationSpec) field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+	immutable := "field is immutable after the EIP is associated"
+
+	if spec.PodNamespace != oldSpec.PodNamespace {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("podNamespace"), immutable))
+	}
+	if spec.PodName != oldSpec.PodName {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("podName"), immutable))
+	}
+	if spec.EipAllocationId != oldSpec.EipAllocationId {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("eipAllocationId"), immutable))
+	}
+	if spec.EipPool != oldSpec.EipPool {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("eipPool"), immutable))
+	}
+	if spec.ManagedEip != oldSpec.ManagedEip {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("managedEip"), immutable))
+	}
+	if spec.Fargate != oldSpec.Fargate {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("fargate"), immutable))
+	}
+
+	if len(spec.SecondaryBindings) != len(oldSpec.SecondaryBindings) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("secondaryBindings"), immutable))
+	} else {
+		for idx := range spec.SecondaryBindings {
+			if spec.SecondaryBindings[idx].EipAllocationId != oldSpec.SecondaryBindings[idx].EipAllocationId {
+				allErrs = append(allErrs, field.Forbidden(
+					specPath.Child("secondaryBindings").Index(idx).Child("eipAllocationId"), immutable))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func invalidAssociation(eipAssociation *ekspodeipv1.EksPodEipAssociation, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		ekspodeipv1.GroupVersion.WithKind("EksPodEipAssociation").GroupKind(), eipAssociation.Name, allErrs)
+}
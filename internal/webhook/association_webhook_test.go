@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+)
+
+func newTestAssociationSpec() ekspodeipv1.EksPodEipAssociationSpec {
+	return ekspodeipv1.EksPodEipAssociationSpec{
+		EipAllocationId: "eipalloc-0123456789abcdef0",
+		PodNamespace:    "ns",
+		PodName:         "pod-0",
+		PrivateIP:       "10.0.0.1",
+		SecondaryBindings: []ekspodeipv1.EipBinding{
+			{PrivateIP: "10.0.1.1", EipAllocationId: "eipalloc-0123abcd"},
+		},
+	}
+}
+
+var _ = Describe("AssociationValidator", func() {
+	fieldsOf := func(spec *ekspodeipv1.EksPodEipAssociationSpec) []string {
+		var fields []string
+		for _, err := range validateAssociationSpec(spec) {
+			fields = append(fields, err.Field)
+		}
+		return fields
+	}
+
+	DescribeTable("validating the spec",
+		func(mutate func(*ekspodeipv1.EksPodEipAssociationSpec), fields ...string) {
+			spec := newTestAssociationSpec()
+			mutate(&spec)
+			if len(fields) == 0 {
+				Expect(fieldsOf(&spec)).To(BeEmpty())
+			} else {
+				Expect(fieldsOf(&spec)).To(ConsistOf(fields))
+			}
+		},
+		Entry("valid spec", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {}),
+		Entry("missing pod", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.PodNamespace = ""
+			spec.PodName = ""
+		}, "spec.podNamespace", "spec.podName"),
+		Entry("missing private IP", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.PrivateIP = ""
+		}, "spec.privateIP"),
+		Entry("IPv6 private IP", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.PrivateIP = "fd00::1"
+		}, "spec.privateIP"),
+		Entry("invalid allocation id", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.EipAllocationId = "eipalloc-xyz"
+		}, "spec.eipAllocationId"),
+		Entry("invalid secondary binding", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.SecondaryBindings[0] = ekspodeipv1.EipBinding{PrivateIP: "10.0.1", EipAllocationId: ""}
+		}, "spec.secondaryBindings[0].privateIP", "spec.secondaryBindings[0].eipAllocationId"),
+		Entry("secondary binding duplicating the pod IP and the EIP", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.SecondaryBindings[0] = ekspodeipv1.EipBinding{PrivateIP: spec.PrivateIP, EipAllocationId: spec.EipAllocationId}
+		}, "spec.secondaryBindings[0].privateIP", "spec.secondaryBindings[0].eipAllocationId"),
+	)
+
+	DescribeTable("validating the spec update",
+		func(mutate func(*ekspodeipv1.EksPodEipAssociationSpec), fields ...string) {
+			oldSpec := newTestAssociationSpec()
+			spec := newTestAssociationSpec()
+			mutate(&spec)
+
+			var errFields []string
+			for _, err := range validateAssociationSpecUpdate(&spec, &oldSpec) {
+				errFields = append(errFields, err.Field)
+			}
+			if len(fields) == 0 {
+				Expect(errFields).To(BeEmpty())
+			} else {
+				Expect(errFields).To(ConsistOf(fields))
+			}
+		},
+		Entry("private IP changed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.PrivateIP = "10.0.0.2"
+		}),
+		Entry("release policy and sticky StatefulSet changed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.ReleasePolicy = ekspodeipv1.EipReleasePolicyRetain
+			spec.StickyStatefulSet = "web"
+		}),
+		Entry("pod changed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.PodNamespace = "other"
+			spec.PodName = "pod-1"
+		}, "spec.podNamespace", "spec.podName"),
+		Entry("EIP changed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.EipAllocationId = "eipalloc-0123456789abcdef1"
+			spec.EipPool = "edge"
+			spec.ManagedEip = true
+		}, "spec.eipAllocationId", "spec.eipPool", "spec.managedEip"),
+		Entry("Fargate changed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.Fargate = true
+		}, "spec.fargate"),
+		Entry("secondary binding EIP changed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.SecondaryBindings[0].EipAllocationId = "eipalloc-0123abce"
+		}, "spec.secondaryBindings[0].eipAllocationId"),
+		Entry("secondary binding removed", func(spec *ekspodeipv1.EksPodEipAssociationSpec) {
+			spec.SecondaryBindings = nil
+		}, "spec.secondaryBindings"),
+	)
+
+	It("checks the immutable fields only after the EIP is associated", func() {
+		validator := &AssociationValidator{}
+
+		oldEipAssociation := &ekspodeipv1.EksPodEipAssociation{Spec: newTestAssociationSpec()}
+		eipAssociation := oldEipAssociation.DeepCopy()
+		eipAssociation.Spec.EipAllocationId = "eipalloc-0123456789abcdef1"
+
+		Expect(validator.ValidateUpdate(context.Background(), oldEipAssociation, eipAssociation)).To(Succeed())
+
+		oldEipAssociation.Status.AssociationId = "eipassoc-0123456789abcdef0"
+		err := validator.ValidateUpdate(context.Background(), oldEipAssociation, eipAssociation)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+	})
+})
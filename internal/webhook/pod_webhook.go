@@ -0,0 +1,346 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ekspodeipv1 "github.com/zhiyanliu/eks-pod-eip/api/v1"
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+	"github.com/zhiyanliu/eks-pod-eip/internal/index"
+	"github.com/zhiyanliu/eks-pod-eip/internal/ipam"
+)
+
+const (
+	podMutatingWebhookPath = "/mutate-v1-pod"
+)
+
+var _ admission.Handler = &PodEipInjector{}
+var _ admission.DecoderInjector = &PodEipInjector{}
+
+// PodEipInjector reserves an EIP for the pod at the admission.
+type PodEipInjector struct {
+	client.Client
+	IPAM *ipam.IPAddressManager
+	// ExcludedNamespaces are the glob patterns of the namespaces the pods are admitted as is in.
+	ExcludedNamespaces []string
+	// WatchNamespaces are the namespaces watched by the controllers, all if empty.
+	WatchNamespaces []string
+
+	decoder *admission.Decoder
+}
+
+// the selectors of the webhook are patched by config/webhook/selector_patch.yaml
+//+kubebuilder:webhook:path=/mutate-v1-pod,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,groups="",resources=pods,verbs=create,versions=v1,name=mpod.ekspodeip.rp.amazonaws.com,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the webhook to the webhook server of the Manager.
+func (i *PodEipInjector) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if i.IPAM == nil {
+		return fmt.Errorf("ipam is not set")
+	}
+
+	mgr.GetWebhookServer().Register(podMutatingWebhookPath, &webhook.Admission{Handler: i})
+
+	return nil
+}
+
+// InjectDecoder injects the decoder of the admission request.
+func (i *PodEipInjector) InjectDecoder(d *admission.Decoder) error {
+	i.decoder = d
+	return nil
+}
+
+// Handle mutates the pod being created, the pod is admitted even if no EIP is reserved.
+func (i *PodEipInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := i.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// the namespace is not set in the object if it is omitted in the request
+	pod.Namespace = req.Namespace
+
+	if internal.NamespaceExcluded(i.ExcludedNamespaces, pod.GetNamespace()) {
+		return admission.Allowed("pod EIP allocation is excluded in the namespace")
+	}
+	if len(i.WatchNamespaces) > 0 && !containsString(i.WatchNamespaces, pod.GetNamespace()) {
+		return admission.Allowed("namespace is not watched")
+	}
+
+	// the pod IP of the host network pod is the primary IP of the node
+	if pod.Spec.HostNetwork {
+		return admission.Allowed("pod EIP allocation is not supported for the host network pod")
+	}
+
+	var ns corev1.Namespace
+	if err := i.Get(ctx, types.NamespacedName{Name: pod.GetNamespace()}, &ns); err != nil {
+		logger.V(1).Error(err, fmt.Sprintf("unable to fetch Namespace %s: %v", pod.GetNamespace(), err))
+		return admission.Allowed("namespace is unknown")
+	}
+
+	policy, err := internal.PodEipPolicy(ctx, i, pod, &ns)
+	if err != nil {
+		logger.V(1).Error(err, fmt.Sprintf("unable to fetch EipPolicy of pod %s/%s%s: %v",
+			pod.GetNamespace(), pod.GetName(), pod.GetGenerateName(), err))
+		return admission.Allowed("EipPolicy is unknown")
+	}
+
+	if !internal.PodEipAllocationEnabled(pod, &ns, policy) {
+		return admission.Allowed("pod EIP allocation is disabled")
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+
+	// only the webhook reserves the EIP, e.g. the annotations might be copied from another pod
+	delete(pod.Annotations, internal.PodEipReservedAnnotation)
+	delete(pod.Annotations, internal.PodEipReservationTokenAnnotation)
+
+	// the finalizer makes sure the EIP is released even the pod is deleted before it is reconciled
+	if !containsString(pod.Finalizers, internal.PodEipFinalizer) {
+		pod.Finalizers = append(pod.Finalizers, internal.PodEipFinalizer)
+	}
+
+	var warnings []string
+
+	_, specified := pod.Annotations[internal.PodEipAllocationIdAnnotation]
+	dryRun := req.DryRun != nil && *req.DryRun
+
+	// no side effect is allowed in dry-run, and the EIP specified by the user is kept
+	if !specified && !dryRun {
+		pool := ipam.PodEipPool(pod, &ns, policy)
+
+		// the pod UID is not assigned at the admission, the reservation is bound to the token instead
+		pod.Annotations[internal.PodEipReservationTokenAnnotation] = string(uuid.NewUUID())
+
+		if eipAllocationId, err := i.IPAM.ReserveEip(pod, pool); err != nil {
+			logger.V(1).Error(err, fmt.Sprintf("unable to reserve EIP for pod %s/%s%s",
+				pod.GetNamespace(), pod.GetName(), pod.GetGenerateName()))
+			warnings = append(warnings, fmt.Sprintf("unable to reserve EIP for the pod: %v", err))
+			delete(pod.Annotations, internal.PodEipReservationTokenAnnotation)
+		} else {
+			pod.Annotations[internal.PodEipAllocationIdAnnotation] = eipAllocationId
+			pod.Annotations[internal.PodEipReservedAnnotation] = "true"
+			if pool != "" {
+				// the pool the EIP is reserved from, the namespace annotation might change later
+				pod.Annotations[internal.PodEipPoolAnnotation] = pool
+			}
+
+			logger.V(1).Info(fmt.Sprintf("EIP %s is reserved for pod %s/%s%s",
+				eipAllocationId, pod.GetNamespace(), pod.GetName(), pod.GetGenerateName()))
+		}
+	}
+
+	marshaledPod, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod).WithWarnings(warnings...)
+}
+
+var _ admission.CustomValidator = &PodEipValidator{}
+
+// PodEipValidator rejects the pod claiming an EIP of another pod.
+type PodEipValidator struct {
+	client.Client
+	// ExcludedNamespaces are the glob patterns of the namespaces the pods are admitted as is in.
+	ExcludedNamespaces []string
+}
+
+// the selectors of the webhook are patched by config/webhook/selector_patch.yaml
+//+kubebuilder:webhook:path=/validate--v1-pod,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create;update,versions=v1,name=vpod.ekspodeip.rp.amazonaws.com,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the webhook to the webhook server of the Manager.
+func (v *PodEipValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.Pod{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *PodEipValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return fmt.Errorf("expected a Pod but got a %T", obj)
+	}
+
+	if v.namespaceExcluded(ctx, pod) {
+		return nil
+	}
+
+	return v.validateEipAllocationId(ctx, pod)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *PodEipValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldPod, ok := oldObj.(*corev1.Pod)
+	if !ok {
+		return fmt.Errorf("expected a Pod but got a %T", oldObj)
+	}
+	pod, ok := newObj.(*corev1.Pod)
+	if !ok {
+		return fmt.Errorf("expected a Pod but got a %T", newObj)
+	}
+
+	if v.namespaceExcluded(ctx, pod) {
+		return nil
+	}
+
+	// the reservation is bound to the token stamped at the admission, it can be removed only
+	if token := pod.GetAnnotations()[internal.PodEipReservationTokenAnnotation]; token != "" &&
+		token != oldPod.GetAnnotations()[internal.PodEipReservationTokenAnnotation] {
+		return invalidPod(pod, field.ErrorList{field.Forbidden(
+			field.NewPath("metadata", "annotations").Key(internal.PodEipReservationTokenAnnotation),
+			"the reservation token is set at the pod admission only")})
+	}
+
+	// the claim is checked when the annotations change only, the pod being deleted must not be blocked
+	if oldPod.GetAnnotations()[internal.PodEipAllocationIdAnnotation] ==
+		pod.GetAnnotations()[internal.PodEipAllocationIdAnnotation] &&
+		oldPod.GetAnnotations()[internal.PodEipCountAnnotation] ==
+			pod.GetAnnotations()[internal.PodEipCountAnnotation] {
+		return nil
+	}
+
+	return v.validateEipAllocationId(ctx, pod)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *PodEipValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// namespaceExcluded checks if the pod is in the namespace excluded from the EIP allocation.
+func (v *PodEipValidator) namespaceExcluded(ctx context.Context, pod *corev1.Pod) bool {
+	namespace := pod.GetNamespace()
+	if namespace == "" {
+		// the namespace is not set in the object if it is omitted in the request
+		if req, err := admission.RequestFromContext(ctx); err == nil {
+			namespace = req.Namespace
+		}
+	}
+
+	return internal.NamespaceExcluded(v.ExcludedNamespaces, namespace)
+}
+
+func (v *PodEipValidator) validateEipAllocationId(ctx context.Context, pod *corev1.Pod) error {
+	var allErrs field.ErrorList
+
+	if count, exists := pod.GetAnnotations()[internal.PodEipCountAnnotation]; exists {
+		if n, err := strconv.Atoi(count); err != nil || n < 1 {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("metadata", "annotations").Key(internal.PodEipCountAnnotation), count,
+				"must be a positive integer"))
+		}
+	}
+
+	value, exists := pod.GetAnnotations()[internal.PodEipAllocationIdAnnotation]
+	if !exists {
+		return invalidPod(pod, allErrs)
+	}
+
+	annotationPath := field.NewPath("metadata", "annotations").Key(internal.PodEipAllocationIdAnnotation)
+
+	eipAllocationIds := ipam.PodEipAllocationIds(pod)
+	if len(eipAllocationIds) == 0 {
+		allErrs = append(allErrs, field.Invalid(annotationPath, value, "must contain at least one EIP allocation id"))
+	}
+
+	for idx, eipAllocationId := range eipAllocationIds {
+		if msg := validateEipAllocationId(eipAllocationId); msg != "" {
+			allErrs = append(allErrs, field.Invalid(annotationPath, eipAllocationId, msg))
+			continue
+		}
+		if containsString(eipAllocationIds[:idx], eipAllocationId) {
+			allErrs = append(allErrs, field.Duplicate(annotationPath, eipAllocationId))
+			continue
+		}
+
+		claimedBy, err := v.eipClaimedBy(ctx, pod, eipAllocationId)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		if claimedBy != "" {
+			allErrs = append(allErrs, field.Forbidden(annotationPath,
+				fmt.Sprintf("EIP %s is claimed by pod %s already", eipAllocationId, claimedBy)))
+		}
+	}
+
+	return invalidPod(pod, allErrs)
+}
+
+// eipClaimedBy returns the other pod claiming the EIP.
+func (v *PodEipValidator) eipClaimedBy(ctx context.Context, pod *corev1.Pod, eipAllocationId string) (string, error) {
+	var eipAssociations ekspodeipv1.EksPodEipAssociationList
+	if err := v.List(ctx, &eipAssociations,
+		client.MatchingFields{index.AssociationEipAllocationIdField: eipAllocationId}); err != nil {
+		return "", fmt.Errorf("unable to list EksPodEipAssociations of EIP %s: %v", eipAllocationId, err)
+	}
+
+	for _, eipAssociation := range eipAssociations.Items {
+		if !eipAssociation.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if eipAssociation.Spec.PodNamespace != pod.GetNamespace() || eipAssociation.Spec.PodName != pod.GetName() {
+			return fmt.Sprintf("%s/%s", eipAssociation.Spec.PodNamespace, eipAssociation.Spec.PodName), nil
+		}
+	}
+
+	var pods corev1.PodList
+	if err := v.List(ctx, &pods, client.MatchingFields{index.PodEipAllocationIdField: eipAllocationId}); err != nil {
+		return "", fmt.Errorf("unable to list pods of EIP %s: %v", eipAllocationId, err)
+	}
+
+	for _, other := range pods.Items {
+		if !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if other.GetNamespace() != pod.GetNamespace() || other.GetName() != pod.GetName() {
+			return fmt.Sprintf("%s/%s", other.GetNamespace(), other.GetName()), nil
+		}
+	}
+
+	return "", nil
+}
+
+func invalidPod(pod *corev1.Pod, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(), pod.GetName(), allErrs)
+}
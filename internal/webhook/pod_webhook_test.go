@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/zhiyanliu/eks-pod-eip/internal"
+)
+
+var _ = Describe("PodEipValidator", func() {
+	var validator *PodEipValidator
+	var ctx context.Context
+
+	newPod := func(namespace string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "pod-0", Annotations: annotations}}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		validator = &PodEipValidator{ExcludedNamespaces: []string{"kube-*"}}
+	})
+
+	It("rejects the reservation token set by the user", func() {
+		oldPod := newPod("ns", nil)
+		pod := newPod("ns", map[string]string{internal.PodEipReservationTokenAnnotation: "token-a"})
+
+		err := validator.ValidateUpdate(ctx, oldPod, pod)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(internal.PodEipReservationTokenAnnotation))
+	})
+
+	It("rejects the reservation token changed by the user", func() {
+		oldPod := newPod("ns", map[string]string{internal.PodEipReservationTokenAnnotation: "token-a"})
+		pod := newPod("ns", map[string]string{internal.PodEipReservationTokenAnnotation: "token-b"})
+
+		Expect(apierrors.IsInvalid(validator.ValidateUpdate(ctx, oldPod, pod))).To(BeTrue())
+	})
+
+	It("allows the reservation token kept or removed", func() {
+		oldPod := newPod("ns", map[string]string{internal.PodEipReservationTokenAnnotation: "token-a"})
+
+		Expect(validator.ValidateUpdate(ctx, oldPod, oldPod.DeepCopy())).To(Succeed())
+		Expect(validator.ValidateUpdate(ctx, oldPod, newPod("ns", nil))).To(Succeed())
+	})
+
+	It("rejects the invalid EIP annotations", func() {
+		pod := newPod("ns", map[string]string{
+			internal.PodEipAllocationIdAnnotation: "eipalloc-xyz",
+			internal.PodEipCountAnnotation:        "0",
+		})
+
+		err := validator.ValidateCreate(ctx, pod)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.(*apierrors.StatusError).ErrStatus.Details.Causes).To(HaveLen(2))
+	})
+
+	It("admits the pods in the excluded namespaces as is", func() {
+		annotations := map[string]string{
+			internal.PodEipAllocationIdAnnotation:     "eipalloc-xyz",
+			internal.PodEipReservationTokenAnnotation: "token-a",
+		}
+
+		Expect(validator.ValidateCreate(ctx, newPod("kube-system", annotations))).To(Succeed())
+		Expect(validator.ValidateUpdate(ctx, newPod("kube-system", nil), newPod("kube-system", annotations))).
+			To(Succeed())
+
+		// the namespace of the request is taken if it is omitted in the pod
+		requestCtx := admission.NewContextWithRequest(ctx, admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{Namespace: "kube-system"},
+		})
+		Expect(validator.ValidateCreate(requestCtx, newPod("", annotations))).To(Succeed())
+	})
+})
+
+var _ = Describe("PodEipInjector", func() {
+	It("admits the pods in the excluded namespaces as is", func() {
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).NotTo(HaveOccurred())
+
+		injector := &PodEipInjector{ExcludedNamespaces: []string{"kube-*"}}
+		Expect(injector.InjectDecoder(decoder)).To(Succeed())
+
+		raw, err := json.Marshal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-0"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		response := injector.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Namespace: "kube-system",
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).To(BeEmpty())
+	})
+})
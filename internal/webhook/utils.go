@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"regexp"
+)
+
+// the allocation id is either in the short format or the long format of the aws resource id
+var eipAllocationIdPattern = regexp.MustCompile(`^eipalloc-([0-9a-f]{8}|[0-9a-f]{17})$`)
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEipAllocationId returns why the EIP allocation id is invalid, or empty.
+func validateEipAllocationId(eipAllocationId string) string {
+	if eipAllocationId == "" {
+		return "must be specified"
+	}
+	if !eipAllocationIdPattern.MatchString(eipAllocationId) {
+		return "must be an EIP allocation id in the format of eipalloc-xxxxxxxx or eipalloc-xxxxxxxxxxxxxxxxx"
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+package webhook
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("validateEipAllocationId",
+	func(eipAllocationId string, valid bool) {
+		Expect(validateEipAllocationId(eipAllocationId) == "").To(Equal(valid))
+	},
+	Entry("short format", "eipalloc-0123abcd", true),
+	Entry("long format", "eipalloc-0123456789abcdef0", true),
+	Entry("empty", "", false),
+	Entry("no prefix", "0123456789abcdef0", false),
+	Entry("other resource", "eni-0123456789abcdef0", false),
+	Entry("upper case", "eipalloc-0123ABCD", false),
+	Entry("neither short nor long", "eipalloc-0123456789", false),
+	Entry("too long", "eipalloc-0123456789abcdef01", false),
+	Entry("surrounded by spaces", " eipalloc-0123abcd ", false),
+)